@@ -12,7 +12,7 @@ import (
 
 func TestGolden(t *testing.T) {
 	engine := rio.NewEngine()
-	names := []string{"branch", "fib", "hi"}
+	names := []string{"bool", "branch", "cast", "change", "class", "closure", "const", "coroutine", "enum", "error", "fib", "float", "generic", "for", "hi", "if", "import", "lambda", "list", "maybe", "method", "operator", "string", "struct", "switch", "tuple", "union", "vartype"}
 	for _, name := range names {
 		updateGolden(engine, name)
 	}
@@ -32,12 +32,17 @@ func updateGolden(engine *rio.Engine, name string) {
 	}
 	defer out.Close()
 	// Process input, and write tree.
-	source, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("%v.rio", name)))
+	module, err := engine.ProcessFile(filepath.Join(dir, fmt.Sprintf("%v.rio", name)))
 	if err != nil {
 		log.Panic(err)
 	}
-	module := engine.Process(string(source))
 	module.Print(out)
+	if len(module.Problems) > 0 {
+		fmt.Fprint(out, "\n--- problems ---\n\n")
+		for _, problem := range module.Problems {
+			fmt.Fprintln(out, problem)
+		}
+	}
 	fmt.Fprint(out, "\n--- run log ---\n\n")
 	// Run program, capturing log.
 	oldOut := log.Writer()
@@ -12,12 +12,11 @@ func main() {
 		return
 	}
 	path := os.Args[1]
-	b, err := os.ReadFile(path)
+	e := rio.NewEngine()
+	module, err := e.ProcessFile(path)
 	if err != nil {
 		log.Panic(err)
 	}
-	e := rio.NewEngine()
-	module := e.Process(string(b))
 	// module.Print()
 	e.Run(module)
 }
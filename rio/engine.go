@@ -1,12 +1,23 @@
 package rio
 
 import (
+	"errors"
+	"io"
 	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 type Engine struct {
 	// Types map[Type]Type // TODO or use unique.Make(type) instead?
 	lexer       lexer
+	loading     []string           // Paths being imported, to find cycles.
+	modules     map[string]*Module // By path, so each is analyzed once.
 	parser      parser
 	resolver    resolver
 	runner      runner
@@ -16,11 +27,32 @@ type Engine struct {
 
 func NewEngine() *Engine {
 	return &Engine{
+		modules:     map[string]*Module{},
 		treeBuilder: newTreeBuilder(),
 	}
 }
 
+// Processes source not from a file, with imports relative to the working
+// directory.
 func (e *Engine) Process(source string) *Module {
+	return e.process(source, "")
+}
+
+// Processes the module at path, along with its imports, reusing any already
+// processed.
+func (e *Engine) ProcessFile(path string) (*Module, error) {
+	path = filepath.Clean(path)
+	if module, ok := e.modules[path]; ok {
+		return module, nil
+	}
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return e.process(string(source), path), nil
+}
+
+func (e *Engine) process(source string, path string) *Module {
 	tokens := e.lexer.Lex(source)
 	// for _, token := range tokens {
 	// 	fmt.Printf("token: %v\n", token)
@@ -28,13 +60,60 @@ func (e *Engine) Process(source string) *Module {
 	parseTree := e.parser.Parse(tokens)
 	// parseTree.Print(os.Stdout)
 	module := e.treeBuilder.Norm(parseTree)
+	module.Path = path
+	if path != "" {
+		e.modules[path] = module
+	}
+	module.Core["Coroutine"] = coroutineType
+	module.Core["coroutine"] = doCoroutine
+	module.Core["Error"] = errorType
+	module.Core["fail"] = doFail
+	module.Core["List"] = listType
 	module.Core["log"] = doLog
+	module.Core["none"] = noneValue
+	module.Core["str"] = doStr
+	for name, typ := range coreTypes {
+		module.Core[name] = typ
+	}
 	// module.Print(os.Stdout)
+	e.loadImports(module)
 	e.analyze(module)
 	// module.Print(os.Stdout)
 	return module
 }
 
+// Processes top-level imports before the importer, since analysis needs their
+// tops.
+func (e *Engine) loadImports(m *Module) {
+	e.loading = append(e.loading, m.Path)
+	defer pop(&e.loading)
+	dir := filepath.Dir(m.Path)
+	for _, kid := range m.Root.(*Block).Kids {
+		imp, ok := kid.(*Import)
+		if !ok || imp.From != nil {
+			continue
+		}
+		path := filepath.Join(dir, imp.Path)
+		if filepath.Ext(path) == "" {
+			path += ".rio"
+		}
+		if i := slices.Index(e.loading, path); i >= 0 {
+			cycle := append(slices.Clone(e.loading[i:]), path)
+			m.problem(imp.Index, "import cycle: "+strings.Join(cycle, " -> "))
+			continue
+		}
+		module, err := e.ProcessFile(path)
+		if err != nil {
+			m.problem(imp.Index, "import failed: "+path)
+			continue
+		}
+		if len(module.Problems) > 0 {
+			m.problem(imp.Index, "import has problems: "+path)
+		}
+		imp.Module = module
+	}
+}
+
 func (e *Engine) Run(m *Module) error {
 	return e.runner.Run(m)
 }
@@ -43,17 +122,144 @@ func (e *Engine) analyze(module *Module) {
 	// TODO Track changes so we can know if more rounds are needed.
 	// TODO What's a good max?
 	e.resolver.core = module.Core
+	// Keep problems from loading imports but only the final round of analysis.
+	loadProblems := len(module.Problems)
 	for i := 0; i < 5; i++ {
+		module.Problems = module.Problems[:loadProblems]
 		// If stable, this shouldn't allocate more on each iteration.
 		e.resolver.Resolve(module)
 		e.typer.Type(module)
 		// TODO Include inlining/macro run phase in the loop?
 	}
+	e.evalConsts(module)
+}
+
+// Replaces const initializers with their values.
+func (e *Engine) evalConsts(module *Module) {
+	for _, v := range e.resolver.consts {
+		switch v.Value.(type) {
+		case *Value:
+			continue
+		}
+		if _, ok := v.Type.(*TypeType); ok {
+			// Type consts are already resolved through their types.
+			continue
+		}
+		if problem := constProblem(v.Value, false, map[Node]bool{}); problem != "" {
+			module.problem(v.Index, problem)
+			continue
+		}
+		value, err := e.runner.Eval(module, v.Value)
+		if err != nil {
+			module.problem(v.Index, "const failed: "+err.Error())
+			continue
+		}
+		v.Value = &Value{NodeInfo: v.NodeInfo, Value: value}
+	}
+}
+
+// Says why node can't be evaluated during analysis, if so. Funs can use their
+// own vars, but nothing can reach plug funs, including log.
+func constProblem(node Node, inFun bool, seen map[Node]bool) string {
+	ref, ok := node.(*Ref)
+	if !ok {
+		problem := ""
+		eachKid(node, func(kid Node) {
+			if problem == "" {
+				problem = constProblem(kid, inFun, seen)
+			}
+		})
+		return problem
+	}
+	if seen[ref.Target] {
+		return ""
+	}
+	switch target := ref.Target.(type) {
+	case *Fun:
+		if target.Flags&NodeFlagPlug != 0 {
+			return "const uses plug fun: " + target.Name
+		}
+		seen[target] = true
+		return constProblem(target, true, seen)
+	case *Record:
+		seen[target] = true
+		return constProblem(target, true, seen)
+	case *Var:
+		if target.Flags&NodeFlagConst == 0 {
+			if !inFun {
+				return "const uses var: " + target.Name
+			}
+			return ""
+		}
+		seen[target] = true
+		return constProblem(target.Value, inFun, seen)
+	}
+	return ""
+}
+
+var coreTypes = map[string]*TypeType{
+	"Any":    {Type: TypeAny},
+	"Bool":   {Type: TypeBool},
+	"Float":  {Type: TypeFloat},
+	"Int":    {Type: TypeInt},
+	"String": {Type: TypeString},
+}
+
+var noneValue = &Value{}
+
+// Letter defaults for untyped vars, replaced by any module-level vartype.
+var defaultVartype = func() []*Var {
+	var vars []*Var
+	for _, name := range []string{"i", "j", "k", "l", "m", "n"} {
+		vars = append(vars, &Var{Def: Def{Name: name}, Type: TypeInt})
+	}
+	for _, name := range []string{"w", "x", "y", "z"} {
+		vars = append(vars, &Var{Def: Def{Name: name}, Type: TypeFloat})
+	}
+	return vars
+}()
+
+// Makes a coroutine from a fun without params, as in `coroutine(fun() ...)`.
+var doCoroutine = &Fun{
+	Def: Def{
+		Name: "coroutine",
+	},
+	Type: FunType{
+		ParamTypes: []Type{&FunType{YieldType: coroutineItem}},
+		RetType: &AppliedType{
+			Record: coroutineType,
+			Args:   []Type{coroutineItem},
+		},
+		TypeParams: []*TypeParam{coroutineItem},
+	},
+	Kids: []Node{func(r *runner, args []any) any {
+		return r.newCoroutine(args[0])
+	}},
+}
+
+// Raises a script error, with an optional payload for handlers.
+var doFail = &Fun{
+	Def: Def{
+		Name: "fail",
+	},
+	Type: FunType{
+		Fails:      true,
+		ParamTypes: []Type{TypeString, TypeAny},
+		RetType:    TypeNever,
+	},
+	Kids: []Node{func(r *runner, args []any) any {
+		err := &RunError{Message: args[0].(string)}
+		if len(args) > 1 {
+			err.Payload = args[1]
+		}
+		panic(err)
+	}},
 }
 
 var doLog = &Fun{
 	Def: Def{
-		Name: "log",
+		Name:  "log",
+		Flags: NodeFlagPlug,
 	},
 	Type: FunType{
 		ParamTypes: []Type{TypeAny},
@@ -63,10 +269,223 @@ var doLog = &Fun{
 		// TODO Option to select where `log` goes?
 		// TODO Specialized formatting for records and more.
 		// TODO Call toString() with some fallback for classes.
-		log.Println(a)
+		if log.Writer() == io.Discard {
+			// Formatting allocates, so skip it when nobody reads.
+			return
+		}
+		log.Println(formatValue(a))
+	}},
+}
+
+// Formats any value as text, as for interpolation.
+var doStr = &Fun{
+	Def: Def{
+		Name: "str",
+	},
+	Type: FunType{
+		ParamTypes: []Type{TypeAny},
+		RetType:    TypeString,
+	},
+	Kids: []Node{func(a any) string { return formatValue(a) }},
+}
+
+var coroutineDone = &Fun{
+	Def: Def{
+		Name: "done",
+	},
+	Type: FunType{
+		ParamTypes: []Type{TypeAny},
+		RetType:    TypeBool,
+	},
+	Kids: []Node{func(r *runner, args []any) any {
+		return args[0].(*Coroutine).done
+	}},
+}
+
+var coroutineItem = &TypeParam{Def: Def{Name: "T"}}
+
+var coroutineResume = &Fun{
+	Def: Def{
+		Name: "resume",
+	},
+	Type: FunType{
+		ParamTypes: []Type{TypeAny},
+		RetType:    maybeType(coroutineItem),
+	},
+	Kids: []Node{func(r *runner, args []any) any {
+		return args[0].(*Coroutine).resume()
+	}},
+}
+
+// Generic over yielded values, as in `Coroutine[Int]`.
+var coroutineType = func() *Record {
+	rec := coreRecord(coroutineDone, coroutineResume)
+	rec.Name = "Coroutine"
+	rec.TypeParams = []Node{coroutineItem}
+	return rec
+}()
+
+// Script errors as caught by try handlers, as in `catch err then err.message`.
+var errorType = func() *Record {
+	message := &Var{Def: Def{Name: "message", Flags: NodeFlagField}}
+	message.Type = TypeString
+	payload := &Var{Def: Def{Name: "payload", Flags: NodeFlagField}}
+	payload.Type = TypeAny
+	payload.Offset = 1
+	rec := &Record{
+		Def:     Def{Name: "Error"},
+		Kind:    TokenClass,
+		Params:  []Node{message, payload},
+		Members: []Node{message, payload},
+		MemberMap: map[string]Node{
+			"message": message,
+			"payload": payload,
+		},
+	}
+	rec.Size = len(rec.Params)
+	rec.Type = FunType{ParamTypes: []Type{TypeString, TypeAny}, RetType: rec}
+	rec.Meta.Type = rec
+	return rec
+}()
+
+var floatAdd = &Fun{
+	Def: Def{
+		Name: "add",
+	},
+	Type: FunType{
+		ParamTypes: []Type{TypeFloat, TypeFloat},
+		RetType:    TypeFloat,
+	},
+	Kids: []Node{func(x, y float64) float64 { return x + y }},
+}
+
+var floatDiv = &Fun{
+	Def: Def{
+		Name: "div",
+	},
+	Type: FunType{
+		ParamTypes: []Type{TypeFloat, TypeFloat},
+		RetType:    TypeFloat,
+	},
+	Kids: []Node{func(x, y float64) float64 {
+		if y == 0 {
+			fail("division by zero")
+		}
+		return x / y
 	}},
 }
 
+var floatEq = &Fun{
+	Def: Def{
+		Name: "eq",
+	},
+	Type: FunType{
+		ParamTypes: []Type{TypeFloat, TypeFloat},
+		RetType:    TypeBool,
+	},
+	Kids: []Node{func(x, y float64) bool { return x == y }},
+}
+
+var floatGe = &Fun{
+	Def: Def{
+		Name: "ge",
+	},
+	Type: FunType{
+		ParamTypes: []Type{TypeFloat, TypeFloat},
+		RetType:    TypeBool,
+	},
+	Kids: []Node{func(x, y float64) bool { return x >= y }},
+}
+
+var floatGt = &Fun{
+	Def: Def{
+		Name: "gt",
+	},
+	Type: FunType{
+		ParamTypes: []Type{TypeFloat, TypeFloat},
+		RetType:    TypeBool,
+	},
+	Kids: []Node{func(x, y float64) bool { return x > y }},
+}
+
+var floatLe = &Fun{
+	Def: Def{
+		Name: "le",
+	},
+	Type: FunType{
+		ParamTypes: []Type{TypeFloat, TypeFloat},
+		RetType:    TypeBool,
+	},
+	Kids: []Node{func(x, y float64) bool { return x <= y }},
+}
+
+var floatLt = &Fun{
+	Def: Def{
+		Name: "lt",
+	},
+	Type: FunType{
+		ParamTypes: []Type{TypeFloat, TypeFloat},
+		RetType:    TypeBool,
+	},
+	Kids: []Node{func(x, y float64) bool { return x < y }},
+}
+
+// Takes the sign of the dividend, as for ints.
+var floatMod = &Fun{
+	Def: Def{
+		Name: "mod",
+	},
+	Type: FunType{
+		ParamTypes: []Type{TypeFloat, TypeFloat},
+		RetType:    TypeFloat,
+	},
+	Kids: []Node{func(x, y float64) float64 {
+		if y == 0 {
+			fail("division by zero")
+		}
+		return math.Mod(x, y)
+	}},
+}
+
+var floatMul = &Fun{
+	Def: Def{
+		Name: "mul",
+	},
+	Type: FunType{
+		ParamTypes: []Type{TypeFloat, TypeFloat},
+		RetType:    TypeFloat,
+	},
+	Kids: []Node{func(x, y float64) float64 { return x * y }},
+}
+
+var floatSub = &Fun{
+	Def: Def{
+		Name: "sub",
+	},
+	Type: FunType{
+		ParamTypes: []Type{TypeFloat, TypeFloat},
+		RetType:    TypeFloat,
+	},
+	Kids: []Node{func(x, y float64) float64 { return x - y }},
+}
+
+// Truncates toward zero.
+var floatToInt = &Fun{
+	Def: Def{
+		Name: "toInt",
+	},
+	Type: FunType{
+		ParamTypes: []Type{TypeFloat},
+		RetType:    TypeInt,
+	},
+	Kids: []Node{func(x float64) int32 { return int32(x) }},
+}
+
+var floatType = coreRecord(
+	floatAdd, floatDiv, floatEq, floatGe, floatGt, floatLe, floatLt, floatMod,
+	floatMul, floatSub, floatToInt,
+)
+
 var intAdd = &Fun{
 	Def: Def{
 		Name: "add",
@@ -78,6 +497,23 @@ var intAdd = &Fun{
 	Kids: []Node{func(i, j int32) int32 { return i + j }},
 }
 
+// Truncates toward zero.
+var intDiv = &Fun{
+	Def: Def{
+		Name: "div",
+	},
+	Type: FunType{
+		ParamTypes: []Type{TypeInt, TypeInt},
+		RetType:    TypeInt,
+	},
+	Kids: []Node{func(i, j int32) int32 {
+		if j == 0 {
+			fail("division by zero")
+		}
+		return i / j
+	}},
+}
+
 var intEq = &Fun{
 	Def: Def{
 		Name: "eq",
@@ -89,6 +525,17 @@ var intEq = &Fun{
 	Kids: []Node{func(i, j int32) bool { return i == j }},
 }
 
+var intGe = &Fun{
+	Def: Def{
+		Name: "ge",
+	},
+	Type: FunType{
+		ParamTypes: []Type{TypeInt, TypeInt},
+		RetType:    TypeBool,
+	},
+	Kids: []Node{func(i, j int32) bool { return i >= j }},
+}
+
 var intGt = &Fun{
 	Def: Def{
 		Name: "gt",
@@ -100,6 +547,17 @@ var intGt = &Fun{
 	Kids: []Node{func(i, j int32) bool { return i > j }},
 }
 
+var intLe = &Fun{
+	Def: Def{
+		Name: "le",
+	},
+	Type: FunType{
+		ParamTypes: []Type{TypeInt, TypeInt},
+		RetType:    TypeBool,
+	},
+	Kids: []Node{func(i, j int32) bool { return i <= j }},
+}
+
 var intLt = &Fun{
 	Def: Def{
 		Name: "lt",
@@ -111,31 +569,288 @@ var intLt = &Fun{
 	Kids: []Node{func(i, j int32) bool { return i < j }},
 }
 
+// Takes the sign of the dividend.
+var intMod = &Fun{
+	Def: Def{
+		Name: "mod",
+	},
+	Type: FunType{
+		ParamTypes: []Type{TypeInt, TypeInt},
+		RetType:    TypeInt,
+	},
+	Kids: []Node{func(i, j int32) int32 {
+		if j == 0 {
+			fail("division by zero")
+		}
+		return i % j
+	}},
+}
+
+var intMul = &Fun{
+	Def: Def{
+		Name: "mul",
+	},
+	Type: FunType{
+		ParamTypes: []Type{TypeInt, TypeInt},
+		RetType:    TypeInt,
+	},
+	Kids: []Node{func(i, j int32) int32 { return i * j }},
+}
+
 var intSub = &Fun{
 	Def: Def{
 		Name: "sub",
 	},
 	Type: FunType{
 		ParamTypes: []Type{TypeInt, TypeInt},
-		RetType:    TypeBool,
+		RetType:    TypeInt,
 	},
 	Kids: []Node{func(i, j int32) int32 { return i - j }},
 }
 
-var intType = func() *Record {
-	members := []Node{
-		intAdd,
-		intEq,
-		intGt,
-		intLt,
-		intSub,
-	}
-	memberMap := make(map[string]Node, len(members))
-	for _, m := range members {
-		memberMap[m.(*Fun).Name] = m
+var intToFloat = &Fun{
+	Def: Def{
+		Name: "toFloat",
+	},
+	Type: FunType{
+		ParamTypes: []Type{TypeInt},
+		RetType:    TypeFloat,
+	},
+	Kids: []Node{func(i int32) float64 { return float64(i) }},
+}
+
+// Equality by identity, as for enum tags and checks for none.
+var anyEq = &Fun{
+	Def: Def{
+		Name: "eq",
+	},
+	Type: FunType{
+		ParamTypes: []Type{TypeAny, TypeAny},
+		RetType:    TypeBool,
+	},
+	Kids: []Node{func(a, b any) bool { return a == b }},
+}
+
+var intType = coreRecord(
+	intAdd, intDiv, intEq, intGe, intGt, intLe, intLt, intMod, intMul, intSub,
+	intToFloat,
+)
+
+// List methods get typed per item type by listMethodType.
+var listEach = &Fun{
+	Def: Def{
+		Name: "each",
+	},
+	Kids: []Node{func(r *runner, args []any) any {
+		list, f := args[0].(*Items), args[1]
+		for _, item := range list.Values {
+			r.callValue(f, item)
+		}
+		return nil
+	}},
+}
+
+var listFilter = &Fun{
+	Def: Def{
+		Name: "filter",
+	},
+	Kids: []Node{func(r *runner, args []any) any {
+		list, f := args[0].(*Items), args[1]
+		kept := &Items{}
+		for _, item := range list.Values {
+			if r.callValue(f, item) == true {
+				kept.Values = append(kept.Values, item)
+			}
+		}
+		return kept
+	}},
+}
+
+var listGet = &Fun{
+	Def: Def{
+		Name: "get",
+	},
+	Kids: []Node{func(r *runner, args []any) any {
+		list := args[0].(*Items)
+		return list.Values[list.index(args[1])]
+	}},
+}
+
+var listLen = &Fun{
+	Def: Def{
+		Name: "len",
+	},
+	Kids: []Node{func(r *runner, args []any) any {
+		return int32(len(args[0].(*Items).Values))
+	}},
+}
+
+var listMap = &Fun{
+	Def: Def{
+		Name: "map",
+	},
+	Kids: []Node{func(r *runner, args []any) any {
+		list, f := args[0].(*Items), args[1]
+		mapped := &Items{Values: make([]any, 0, len(list.Values))}
+		for _, item := range list.Values {
+			mapped.Values = append(mapped.Values, r.callValue(f, item))
+		}
+		return mapped
+	}},
+}
+
+var listPop = &Fun{
+	Def: Def{
+		Name: "pop",
+	},
+	Kids: []Node{func(r *runner, args []any) any {
+		list := args[0].(*Items)
+		if len(list.Values) == 0 {
+			fail("pop from empty list")
+		}
+		return pop(&list.Values)
+	}},
+}
+
+var listPush = &Fun{
+	Def: Def{
+		Name: "push",
+	},
+	Kids: []Node{func(r *runner, args []any) any {
+		list := args[0].(*Items)
+		list.Values = append(list.Values, args[1])
+		return nil
+	}},
+}
+
+var listSet = &Fun{
+	Def: Def{
+		Name: "set",
+	},
+	Kids: []Node{func(r *runner, args []any) any {
+		list := args[0].(*Items)
+		list.Values[list.index(args[1])] = args[2]
+		return nil
+	}},
+}
+
+var listItem = &TypeParam{Def: Def{Name: "T"}}
+
+// Also names list types, as in `List[Int]` for `*Int`, where bare `List` is
+// a list of anything.
+var listType = func() *Record {
+	rec := coreRecord(
+		listEach, listFilter, listGet, listLen, listMap, listPop, listPush,
+		listSet,
+	)
+	rec.Name = "List"
+	rec.TypeParams = []Node{listItem}
+	rec.Meta.Type = ListType{ItemType: TypeAny}
+	return rec
+}()
+
+var stringAdd = &Fun{
+	Def: Def{
+		Name: "add",
+	},
+	Type: FunType{
+		ParamTypes: []Type{TypeString, TypeString},
+		RetType:    TypeString,
+	},
+	Kids: []Node{func(a, b string) string { return a + b }},
+}
+
+// Splits around the first sep, also saying whether sep was found.
+var stringCut = &Fun{
+	Def: Def{
+		Name: "cut",
+	},
+	Type: FunType{
+		ParamTypes: []Type{TypeString, TypeString},
+		RetType:    tupleOf(TypeString, TypeString, TypeBool),
+	},
+	Kids: []Node{strings.Cut},
+}
+
+var stringEq = &Fun{
+	Def: Def{
+		Name: "eq",
+	},
+	Type: FunType{
+		ParamTypes: []Type{TypeString, TypeString},
+		RetType:    TypeBool,
+	},
+	Kids: []Node{func(a, b string) bool { return a == b }},
+}
+
+// Counts runes rather than bytes.
+var stringLen = &Fun{
+	Def: Def{
+		Name: "len",
+	},
+	Type: FunType{
+		ParamTypes: []Type{TypeString},
+		RetType:    TypeInt,
+	},
+	Kids: []Node{func(a string) int32 {
+		return int32(utf8.RuneCountInString(a))
+	}},
+}
+
+// Fails unless the whole string is a decimal int.
+var stringToInt = &Fun{
+	Def: Def{
+		Name: "toInt",
+	},
+	Type: FunType{
+		Fails:      true,
+		ParamTypes: []Type{TypeString},
+		RetType:    TypeInt,
+	},
+	Kids: []Node{func(a string) (int32, error) {
+		i, err := strconv.ParseInt(a, 10, 32)
+		if err != nil {
+			return 0, errors.New("not an int: " + a)
+		}
+		return int32(i), nil
+	}},
+}
+
+var stringType = coreRecord(
+	stringAdd, stringCut, stringEq, stringLen, stringToInt,
+)
+
+// Tuple methods get typed per tuple by tupleMethodType.
+var tupleGet = &Fun{
+	Def: Def{
+		Name: "get",
+	},
+	Kids: []Node{func(r *runner, args []any) any {
+		return args[0].(*Pack).Values[args[1].(int32)]
+	}},
+}
+
+var tupleLen = &Fun{
+	Def: Def{
+		Name: "len",
+	},
+	Kids: []Node{func(r *runner, args []any) any {
+		return int32(len(args[0].(*Pack).Values))
+	}},
+}
+
+var tupleType = coreRecord(tupleGet, tupleLen)
+
+// Makes a record of methods for a built-in type.
+func coreRecord(funs ...*Fun) *Record {
+	members := make([]Node, len(funs))
+	memberMap := make(map[string]Node, len(funs))
+	for i, f := range funs {
+		members[i] = f
+		memberMap[f.Name] = f
 	}
 	return &Record{
 		Members:   members,
 		MemberMap: memberMap,
 	}
-}()
+}
@@ -29,21 +29,29 @@ type TokenKind int
 const (
 	TokenNone TokenKind = iota
 	TokenAdd
+	TokenAddEq
+	TokenAmp
+	TokenAnd
 	TokenAs
 	TokenBreak
 	TokenCase
+	TokenCatch
 	TokenChange
 	TokenClass
+	TokenColon
 	TokenComma
 	TokenCommentOpen
 	TokenCommentText
 	TokenConst
 	TokenContinue
+	TokenDot
 	TokenElse
 	TokenEnd
 	TokenEq
 	TokenEqEq
 	TokenEnum
+	TokenFalse
+	TokenFloat
 	TokenFor
 	TokenFrom
 	TokenFun
@@ -52,6 +60,7 @@ const (
 	TokenHSpace
 	TokenId
 	TokenIf
+	TokenIn
 	TokenInt
 	TokenIs
 	TokenImport
@@ -60,24 +69,40 @@ const (
 	TokenJunk
 	TokenNot
 	TokenNEq
+	TokenOr
+	TokenPercent
+	TokenPercentEq
 	TokenPlug
 	TokenPub
+	TokenQuestion
 	TokenReturn
 	TokenRoundClose
 	TokenRoundOpen
+	TokenSlash
+	TokenSlashEq
+	TokenSquareClose
+	TokenSquareOpen
+	TokenStar
+	TokenStarEq
 	TokenStringEscape
+	TokenStringExprClose
+	TokenStringExprOpen
 	TokenStringText
 	TokenStringClose
 	TokenStringOpen
 	TokenStruct
 	TokenSub
+	TokenSubEq
 	TokenSwitch
 	TokenThen
+	TokenTrue
+	TokenTry
 	TokenVSpace
 	TokenUnion
 	TokenUse
 	TokenVar
 	TokenVartype
+	TokenYield
 )
 
 //go:generate stringer -type=TokenKind
@@ -92,92 +117,132 @@ type lexer struct {
 
 func (l *lexer) lex() {
 	for l.has() {
-		r := l.peek()
-		switch {
-		case unicode.IsLetter(r) || r == '$' || r == '_':
-			l.id()
-		case r >= '0' && r <= '9':
-			l.number()
-		case r == ' ' || r == '\t':
-			l.hspace()
-		default:
-			start := l.index
-			switch r {
-			case '#':
-				l.next()
-				l.push(TokenCommentOpen, start)
-				l.comment()
-			case '"':
-				l.next()
-				l.push(TokenStringOpen, start)
-				l.str()
+		l.token()
+	}
+}
+
+func (l *lexer) token() {
+	r := l.peek()
+	switch {
+	case unicode.IsLetter(r) || r == '$' || r == '_':
+		l.id()
+	case r >= '0' && r <= '9':
+		l.number()
+	case r == ' ' || r == '\t':
+		l.hspace()
+	default:
+		start := l.index
+		switch r {
+		case '#':
+			l.next()
+			l.push(TokenCommentOpen, start)
+			l.comment()
+		case '"':
+			l.next()
+			l.push(TokenStringOpen, start)
+			l.str()
+		case '=':
+			l.next()
+			switch r := l.peek(); r {
 			case '=':
 				l.next()
-				switch r := l.peek(); r {
-				case '=':
-					l.next()
-					l.push(TokenEqEq, start)
-				default:
-					l.push(TokenEq, start)
-				}
-			case '+':
-				l.next()
-				switch r := l.peek(); r {
-				// TODO Compound operators.
-				default:
-					l.push(TokenAdd, start)
-				}
-			case '-':
-				l.next()
-				switch r := l.peek(); r {
-				// TODO Compound operators.
-				default:
-					l.push(TokenSub, start)
-				}
-			case '<':
-				l.next()
-				switch r := l.peek(); r {
-				case '=':
-					l.next()
-					l.push(TokenLe, start)
-				default:
-					l.push(TokenLt, start)
-				}
-			case '>':
-				l.next()
-				switch r := l.peek(); r {
-				case '=':
-					l.next()
-					l.push(TokenGe, start)
-				default:
-					l.push(TokenGt, start)
-				}
-			case ',':
-				l.next()
-				l.push(TokenComma, start)
-			case '(':
-				l.next()
-				l.push(TokenRoundOpen, start)
-			case ')':
+				l.push(TokenEqEq, start)
+			default:
+				l.push(TokenEq, start)
+			}
+		case '!':
+			l.next()
+			switch r := l.peek(); r {
+			case '=':
 				l.next()
-				l.push(TokenRoundClose, start)
-			case '\r':
+				l.push(TokenNEq, start)
+			default:
+				l.push(TokenJunk, start)
+			}
+		case '+':
+			l.opEq(TokenAdd, TokenAddEq)
+		case '-':
+			l.opEq(TokenSub, TokenSubEq)
+		case '%':
+			l.opEq(TokenPercent, TokenPercentEq)
+		case '/':
+			l.opEq(TokenSlash, TokenSlashEq)
+		case '<':
+			l.next()
+			switch r := l.peek(); r {
+			case '=':
 				l.next()
-				if l.peek() == '\n' {
-					l.next()
-				}
-				l.push(TokenVSpace, start)
-			case '\n':
+				l.push(TokenLe, start)
+			default:
+				l.push(TokenLt, start)
+			}
+		case '>':
+			l.next()
+			switch r := l.peek(); r {
+			case '=':
 				l.next()
-				l.push(TokenVSpace, start)
+				l.push(TokenGe, start)
 			default:
+				l.push(TokenGt, start)
+			}
+		case '*':
+			l.opEq(TokenStar, TokenStarEq)
+		case '&':
+			l.next()
+			l.push(TokenAmp, start)
+		case ':':
+			l.next()
+			l.push(TokenColon, start)
+		case ',':
+			l.next()
+			l.push(TokenComma, start)
+		case '.':
+			l.next()
+			l.push(TokenDot, start)
+		case '?':
+			l.next()
+			l.push(TokenQuestion, start)
+		case '(':
+			l.next()
+			l.push(TokenRoundOpen, start)
+		case ')':
+			l.next()
+			l.push(TokenRoundClose, start)
+		case '[':
+			l.next()
+			l.push(TokenSquareOpen, start)
+		case ']':
+			l.next()
+			l.push(TokenSquareClose, start)
+		case '\r':
+			l.next()
+			if l.peek() == '\n' {
 				l.next()
-				l.push(TokenJunk, start)
 			}
+			l.push(TokenVSpace, start)
+		case '\n':
+			l.next()
+			l.push(TokenVSpace, start)
+		default:
+			l.next()
+			l.push(TokenJunk, start)
 		}
 	}
 }
 
+// Pushes either the operator or its compound assignment, as in `+=`.
+func (l *lexer) opEq(op TokenKind, opEq TokenKind) {
+	start := l.index
+	l.next()
+	switch r := l.peek(); r {
+	case '=':
+		l.next()
+		l.push(opEq, start)
+	default:
+		l.push(op, start)
+	}
+}
+
 func (l *lexer) has() bool {
 	return l.index < len(l.source)
 }
@@ -268,60 +333,128 @@ Id:
 func (l *lexer) number() {
 	start := l.index
 	// TODO Include negative in int literal?
-Int:
-	for l.has() {
-		r := l.peek()
-		switch {
-		case r >= '0' && r <= '9':
+	kind := TokenInt
+	l.digits()
+	// Fraction, but not a method call, as in `1.add(2)`.
+	if l.peek() == '.' && isDigitAt(l.source, l.index+1) {
+		kind = TokenFloat
+		l.next()
+		l.digits()
+	}
+	// Exponent, as in `1e9` or `2.5e-3`, kept even if missing digits so it
+	// gets reported rather than becoming a name.
+	if r := l.peek(); r == 'e' || r == 'E' {
+		kind = TokenFloat
+		l.next()
+		if r := l.peek(); r == '+' || r == '-' {
 			l.next()
-		default:
-			break Int
 		}
+		l.digits()
+	}
+	l.push(kind, start)
+}
+
+func (l *lexer) digits() {
+	for l.has() {
+		if r := l.peek(); r < '0' || r > '9' {
+			return
+		}
+		l.next()
 	}
-	// TODO Check if it's a float literal at this point.
-	l.push(TokenInt, start)
+}
+
+func isDigitAt(s string, i int) bool {
+	return i < len(s) && s[i] >= '0' && s[i] <= '9'
 }
 
 func (l *lexer) str() {
 	start := l.index
-	kind := TokenStringText
 Str:
 	for l.has() {
-		r := l.peek()
-		if r == '\n' {
-			break Str
-		}
-		if kind == TokenStringEscape {
-			l.next()
-			l.push(kind, start)
-			kind = TokenStringText
-			start = l.index
-			continue Str
-		}
-		switch r {
+		switch r := l.peek(); r {
 		case '"':
-			l.push(kind, start)
+			l.push(TokenStringText, start)
 			start = l.index
 			l.next()
-			kind = TokenStringClose
-			break Str
+			l.push(TokenStringClose, start)
+			return
 		case '\n':
 			break Str
 		case '\\':
-			l.push(kind, start)
-			kind = TokenStringEscape
+			l.push(TokenStringText, start)
 			start = l.index
+			l.next()
+			switch r := l.peek(); r {
+			case '(':
+				l.next()
+				l.push(TokenStringExprOpen, start)
+				l.strExpr()
+			case 'u':
+				// Hex code point, as in `\u(1f600)`.
+				l.next()
+				if l.peek() == '(' {
+				Hex:
+					for l.has() {
+						switch r := l.peek(); r {
+						case '"', '\n':
+							break Hex
+						case ')':
+							l.next()
+							break Hex
+						}
+						l.next()
+					}
+				}
+				l.push(TokenStringEscape, start)
+			case '\n':
+				l.push(TokenStringEscape, start)
+			default:
+				l.next()
+				l.push(TokenStringEscape, start)
+			}
+			start = l.index
+			continue Str
 		}
 		l.next()
 	}
-	l.push(kind, start)
+	l.push(TokenStringText, start)
+}
+
+// Lexes an interpolated expression through its closing paren.
+func (l *lexer) strExpr() {
+	depth := 0
+	for l.has() {
+		switch r := l.peek(); r {
+		case '\n':
+			return
+		case ')':
+			if depth == 0 {
+				start := l.index
+				l.next()
+				l.push(TokenStringExprClose, start)
+				return
+			}
+		}
+		count := len(l.tokens)
+		l.token()
+		if len(l.tokens) > count {
+			switch l.tokens[len(l.tokens)-1].Kind {
+			case TokenRoundClose:
+				depth--
+			case TokenRoundOpen:
+				depth++
+			}
+		}
+	}
 }
 
 // We have keys only for things that affect parsing?
 var keys = map[string]TokenKind{
+	"and":      TokenAnd,
 	"as":       TokenAs,
 	"break":    TokenBreak,
 	"case":     TokenCase,
+	"catch":    TokenCatch,
 	"class":    TokenClass,
 	"change":   TokenChange,
 	"const":    TokenConst,
@@ -329,20 +462,27 @@ var keys = map[string]TokenKind{
 	"else":     TokenElse,
 	"end":      TokenEnd,
 	"if":       TokenIf,
+	"in":       TokenIn,
 	"is":       TokenIs,
 	"import":   TokenImport,
 	"enum":     TokenEnum,
+	"false":    TokenFalse,
 	"for":      TokenFor,
 	"from":     TokenFrom,
 	"fun":      TokenFun,
+	"not":      TokenNot,
+	"or":       TokenOr,
 	"plug":     TokenPlug,
 	"pub":      TokenPub,
 	"return":   TokenReturn,
 	"struct":   TokenStruct,
 	"switch":   TokenSwitch,
 	"then":     TokenThen,
+	"true":     TokenTrue,
+	"try":      TokenTry,
 	"union":    TokenUnion,
 	"use":      TokenUse,
 	"var":      TokenVar,
 	"vartype":  TokenVartype,
+	"yield":    TokenYield,
 }
@@ -10,22 +10,37 @@ func _() {
 	var x [1]struct{}
 	_ = x[NodeNone-0]
 	_ = x[NodeArgs-1]
-	_ = x[NodeBlock-2]
-	_ = x[NodeCall-3]
-	_ = x[NodeCase-4]
-	_ = x[NodeFun-5]
-	_ = x[NodeGet-6]
-	_ = x[NodeRef-7]
-	_ = x[NodeReturn-8]
-	_ = x[NodeSwitch-9]
-	_ = x[NodeType-10]
-	_ = x[NodeValue-11]
-	_ = x[NodeVar-12]
+	_ = x[NodeAssign-2]
+	_ = x[NodeBlock-3]
+	_ = x[NodeCall-4]
+	_ = x[NodeCase-5]
+	_ = x[NodeCast-6]
+	_ = x[NodeFor-7]
+	_ = x[NodeFun-8]
+	_ = x[NodeFunSpec-9]
+	_ = x[NodeGet-10]
+	_ = x[NodeImport-11]
+	_ = x[NodeList-12]
+	_ = x[NodeLogic-13]
+	_ = x[NodeMaybe-14]
+	_ = x[NodeRecord-15]
+	_ = x[NodeRef-16]
+	_ = x[NodeReturn-17]
+	_ = x[NodeSwitch-18]
+	_ = x[NodeTag-19]
+	_ = x[NodeTry-20]
+	_ = x[NodeTuple-21]
+	_ = x[NodeType-22]
+	_ = x[NodeTypeParam-23]
+	_ = x[NodeUnpack-24]
+	_ = x[NodeValue-25]
+	_ = x[NodeVar-26]
+	_ = x[NodeVartype-27]
 }
 
-const _NodeKind_name = "NodeNoneNodeArgsNodeBlockNodeCallNodeCaseNodeFunNodeGetNodeRefNodeReturnNodeSwitchNodeTypeNodeValueNodeVar"
+const _NodeKind_name = "NodeNoneNodeArgsNodeAssignNodeBlockNodeCallNodeCaseNodeCastNodeForNodeFunNodeFunSpecNodeGetNodeImportNodeListNodeLogicNodeMaybeNodeRecordNodeRefNodeReturnNodeSwitchNodeTagNodeTryNodeTupleNodeTypeNodeTypeParamNodeUnpackNodeValueNodeVarNodeVartype"
 
-var _NodeKind_index = [...]uint8{0, 8, 16, 25, 33, 41, 48, 55, 62, 72, 82, 90, 99, 106}
+var _NodeKind_index = [...]uint8{0, 8, 16, 26, 35, 43, 51, 59, 66, 73, 84, 91, 101, 109, 118, 127, 137, 144, 154, 164, 171, 178, 187, 195, 208, 218, 227, 234, 245}
 
 func (i NodeKind) String() string {
 	idx := int(i) - 0
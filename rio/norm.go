@@ -1,8 +1,11 @@
 package rio
 
 import (
+	"path"
+	"slices"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 func (b *treeBuilder) Norm(p ParseNode) *Module {
@@ -24,20 +27,42 @@ func (b *treeBuilder) normNode(p ParseNode) {
 	switch p.Kind {
 	case ParseArgs:
 		b.normArgs(p)
+	case ParseAssign:
+		b.normAssign(p)
 	case ParseBlock:
 		b.normBlock(p)
 	case ParseCall:
 		b.normCall(p)
 	case ParseCase:
 		b.normCase(p)
+	case ParseClass:
+		b.normClass(p)
 	case ParseElse:
 		b.normElse(p)
+	case ParseEnum:
+		b.normEnum(p)
+	case ParseFor:
+		b.normFor(p)
 	case ParseFun:
 		b.normFun(p)
+	case ParseFunType:
+		b.normFunType(p)
+	case ParseGet:
+		b.normGet(p)
+	case ParseIf:
+		b.normIf(p)
+	case ParseImport:
+		b.normImport(p)
+	case ParseIndex:
+		b.normIndex(p)
 	case ParseInfix:
 		b.normInfix(p)
 	case ParseJunk:
 		b.normJunk(p)
+	case ParseLabel:
+		b.normLabel(p)
+	case ParseList:
+		b.normList(p)
 	case ParseModify:
 		b.normModify(p)
 	case ParseNone:
@@ -52,12 +77,20 @@ func (b *treeBuilder) normNode(p ParseNode) {
 		b.normReturn(p)
 	case ParseString:
 		b.normString(p)
+	case ParseStruct:
+		b.normStruct(p)
 	case ParseSwitch, ParseSwitchEmpty:
 		b.normSwitch(p)
 	case ParseToken:
 		b.normToken(p)
+	case ParseTry:
+		b.normTry(p)
+	case ParseTuple:
+		b.normTuple(p)
 	case ParseVar:
 		b.normVar(p)
+	case ParseVartype:
+		b.normVartype(p)
 	}
 }
 
@@ -87,8 +120,15 @@ func (b *treeBuilder) normArgs(p ParseNode) {
 
 func (b *treeBuilder) normArgItems(p ParseNode, next int) (ParseNode, int) {
 	start := len(b.work)
+	part, next := b.normItems(p, next)
+	b.commitBlock(start)
+	return part, next
+}
+
+// Normalizes items up to a closing token, leaving them as work.
+func (b *treeBuilder) normItems(p ParseNode, next int) (ParseNode, int) {
 	part := ParseNode{}
-Args:
+Items:
 	for {
 		next, part = p.Next(next)
 		switch part.Kind {
@@ -96,20 +136,142 @@ Args:
 			switch part.Token.Kind {
 			case TokenComma:
 				// TODO Error on repeated.
-				continue Args
-			case TokenRoundClose:
-				break Args
+				continue Items
+			case TokenRoundClose, TokenSquareClose:
+				break Items
 			default:
 			}
 		case ParseNone:
-			break Args
+			break Items
+		case ParseFor:
+			if isForLambda(part) {
+				b.normForLambda(part)
+				continue Items
+			}
 		}
 		b.normNode(part)
 	}
-	b.commitBlock(start)
 	return part, next
 }
 
+func (b *treeBuilder) normAssign(p ParseNode) {
+	a := inAssign{}
+	start := len(b.work)
+	next, part := p.Next(0)
+	next, op := p.Next(next)
+	_, value := p.Next(next)
+	// Compound assignment, as in `a += b`, normalizes the target twice.
+	name := opMethods[op.Token.Kind]
+	if part.Kind == ParseIndex && name != "" {
+		b.normIndexUpdate(part, name, value)
+		return
+	}
+	if part.Kind == ParseGet && name != "" {
+		_, subject := part.Next(0)
+		if subject.Kind != ParseToken || subject.Token.Kind != TokenId {
+			// Plain names have no effects to repeat.
+			b.normGetUpdate(part, name, value)
+			return
+		}
+	}
+	normValue := func() {
+		switch name {
+		case "":
+			b.normNode(value)
+		default:
+			b.normOpCall(part, name, value)
+		}
+	}
+	if part.Kind == ParseIndex {
+		// Assign through a set method, as in `xs.set(i, x)`.
+		afterSubject, subject := part.Next(0)
+		_, index := part.Next(afterSubject)
+		b.normMethodCall(subject, "set", index, normValue)
+		return
+	}
+	a.target = b.normNodeCommit(part)
+	valueStart := len(b.work)
+	normValue()
+	b.commitHeadless(valueStart)
+	a.value = Idx[inNode](len(b.nodes) - 1)
+	b.commit(inNode{kind: NodeAssign, index: len(b.assigns)}, start)
+	b.assigns = append(b.assigns, a)
+}
+
+// Normalizes `xs[i] += x` so that xs and i each run once, into a block like
+// `var $subject = xs; var $index = i; $subject.set($index, ...)`, where the
+// names can't clash with any in source.
+func (b *treeBuilder) normIndexUpdate(p ParseNode, name string, value ParseNode) {
+	start := len(b.work)
+	afterSubject, subject := p.Next(0)
+	_, index := p.Next(afterSubject)
+	b.pushTempVar("$subject", func() { b.normNode(subject) })
+	b.pushTempVar("$index", func() {
+		b.normItems(index, index.ExpectToken(0, TokenSquareOpen))
+	})
+	setStart := len(b.work)
+	b.pushRef("$subject")
+	b.pushOpCall(setStart, "set", func() {
+		b.pushRef("$index")
+		opStart := len(b.work)
+		b.pushRef("$subject")
+		b.pushOpCall(opStart, "get", func() { b.pushRef("$index") })
+		b.pushOpCall(opStart, name, func() { b.normNode(value) })
+	})
+	b.commitBlock(start)
+}
+
+// Normalizes `f().n += x` so that f runs once, into a block like
+// `var $subject = f(); $subject.n = $subject.n.add(x)`.
+func (b *treeBuilder) normGetUpdate(p ParseNode, name string, value ParseNode) {
+	start := len(b.work)
+	afterSubject, subject := p.Next(0)
+	_, member := p.Next(p.ExpectToken(afterSubject, TokenDot))
+	b.pushTempVar("$subject", func() { b.normNode(subject) })
+	a := inAssign{}
+	assignStart := len(b.work)
+	b.pushTempGet("$subject", member)
+	b.commitHeadless(assignStart)
+	a.target = Idx[inNode](len(b.nodes) - 1)
+	valueStart := len(b.work)
+	b.pushTempGet("$subject", member)
+	b.pushOpCall(valueStart, name, func() { b.normNode(value) })
+	b.commitHeadless(valueStart)
+	a.value = Idx[inNode](len(b.nodes) - 1)
+	b.commit(inNode{kind: NodeAssign, index: len(b.assigns)}, assignStart)
+	b.assigns = append(b.assigns, a)
+	b.commitBlock(start)
+}
+
+// Pushes a get of member from the temp var with the given name.
+func (b *treeBuilder) pushTempGet(name string, member ParseNode) {
+	start := len(b.work)
+	get := inGet{}
+	b.pushRef(name)
+	b.commitHeadless(start)
+	get.subject = Idx[inNode](len(b.nodes) - 1)
+	get.member = b.normNodeCommit(member)
+	b.commit(inNode{kind: NodeGet, index: len(b.gets)}, start)
+	b.gets = append(b.gets, get)
+}
+
+// Pushes a var initialized by whatever normValue pushes. Temps share rather
+// than copy, so changes through them still reach struct fields.
+func (b *treeBuilder) pushTempVar(name string, normValue func()) {
+	v := inVar{Def: Def{Name: name, Flags: NodeFlagTemp}}
+	valueStart := len(b.work)
+	normValue()
+	b.commitHeadless(valueStart)
+	v.value = Idx[inNode](len(b.nodes) - 1)
+	b.pushWork(inNode{kind: NodeVar, index: len(b.vars)})
+	b.vars = append(b.vars, v)
+}
+
+func (b *treeBuilder) pushRef(name string) {
+	b.pushWork(inNode{kind: NodeRef, index: len(b.refs)})
+	b.refs = append(b.refs, name)
+}
+
 func (b *treeBuilder) normBlock(p ParseNode) {
 	start := len(b.work)
 	for _, kid := range p.Kids {
@@ -146,6 +308,11 @@ func (b *treeBuilder) normCase(p ParseNode) {
 		c.patterns = b.popWorkBlock()
 		next, part = p.Next(next)
 	}
+	if part.Token.Kind == TokenIf {
+		next, part = p.Next(next)
+		c.gate = b.normNodeCommit(part)
+		next, part = p.Next(next)
+	}
 	if part.Kind == ParseBlock {
 		b.normBlock(part)
 		c.kids = b.popWorkBlock()
@@ -155,6 +322,39 @@ func (b *treeBuilder) normCase(p ParseNode) {
 	b.cases = append(b.cases, c)
 }
 
+func (b *treeBuilder) normClass(p ParseNode) {
+	r := inRecord{kind: TokenClass}
+	next := p.ExpectToken(0, TokenClass)
+	next, part := p.Next(next)
+	if part.Token.Kind == TokenId {
+		r.Name = part.Token.Text
+		next, part = p.Next(next)
+	}
+	if part.Kind == ParseList {
+		r.typeParams = b.normTypeParams(part)
+		next, part = p.Next(next)
+	}
+	if part.Kind == ParseParams {
+		b.normParams(part)
+		r.params = b.popWorkBlock()
+		next, part = p.Next(next)
+	}
+	switch {
+	case part.Kind == ParseBlock:
+		b.normBlock(part)
+		r.kids = b.popWorkBlock()
+		next, part = p.Next(next)
+	case part.Token.Kind == TokenEnd:
+		next, part = p.Next(next)
+	}
+	if part.Token.Kind == TokenClass {
+		_, part = p.Next(next)
+	}
+	b.expectNone(part)
+	b.pushWork(inNode{kind: NodeRecord, index: len(b.records)})
+	b.records = append(b.records, r)
+}
+
 func (b *treeBuilder) normElse(p ParseNode) {
 	c := inCase{always: true}
 	next := p.ExpectToken(0, TokenElse)
@@ -168,54 +368,415 @@ func (b *treeBuilder) normElse(p ParseNode) {
 	b.cases = append(b.cases, c)
 }
 
+// Normalizes enums and unions, where union members with params are variant
+// records whose params are all fields.
+func (b *treeBuilder) normEnum(p ParseNode) {
+	next, part := p.Next(0)
+	r := inRecord{kind: part.Token.Kind}
+	next, part = p.Next(next)
+	if part.Token.Kind == TokenId {
+		r.Name = part.Token.Text
+		next, part = p.Next(next)
+	}
+	if part.Kind == ParseList {
+		r.typeParams = b.normTypeParams(part)
+		next, part = p.Next(next)
+	}
+	start := len(b.work)
+Members:
+	for {
+		switch part.Token.Kind {
+		case TokenComma:
+		case TokenId:
+			name := part.Token.Text
+			afterName, params := p.Next(next)
+			if params.Kind != ParseParams {
+				b.pushWork(inNode{kind: NodeTag, index: len(b.tags)})
+				b.tags = append(b.tags, name)
+				break
+			}
+			next = afterName
+			variant := inRecord{Def: Def{Name: name}, kind: TokenClass}
+			variant.params = b.normFieldParams(params)
+			b.pushWork(inNode{kind: NodeRecord, index: len(b.records)})
+			b.records = append(b.records, variant)
+		default:
+			break Members
+		}
+		next, part = p.Next(next)
+	}
+	b.commitBlock(start)
+	r.kids = b.popWorkBlock()
+	if part.Token.Kind == TokenEnd {
+		next, part = p.Next(next)
+	}
+	if part.Token.Kind == r.kind {
+		_, part = p.Next(next)
+	}
+	b.expectNone(part)
+	b.pushWork(inNode{kind: NodeRecord, index: len(b.records)})
+	b.records = append(b.records, r)
+}
+
+func (b *treeBuilder) normFor(p ParseNode) {
+	f := inFor{}
+	next := p.ExpectToken(0, TokenFor)
+	next, part := p.Next(next)
+	if part.Kind != ParseBlock && part.Token.Kind != TokenThen {
+		subject := part
+		next, part = p.Next(next)
+		if part.Token.Kind == TokenIn {
+			// Iteration, so the first part was the item name.
+			start := len(b.work)
+			b.pushWork(inNode{kind: NodeVar, index: len(b.vars)})
+			b.vars = append(b.vars, inVar{Def: Def{Name: subject.Token.Text}})
+			b.commitHeadless(start)
+			f.item = Idx[inNode](len(b.nodes) - 1)
+			next, subject = p.Next(next)
+			next, part = p.Next(next)
+		}
+		f.subject = b.normNodeCommit(subject)
+	}
+	if part.Token.Kind == TokenThen {
+		next, part = p.Next(next)
+	}
+	switch part.Kind {
+	case ParseBlock:
+		b.normBlock(part)
+	default:
+		// Inline body.
+		start := len(b.work)
+		b.normNode(part)
+		b.commitBlock(start)
+	}
+	f.kids = b.popWorkBlock()
+	_, part = p.Next(next)
+	b.expectNone(part)
+	b.pushWork(inNode{kind: NodeFor, index: len(b.fors)})
+	b.fors = append(b.fors, f)
+}
+
+// Says if a loop is lambda shorthand, as in `map(for x then x + 1)`, since
+// only loops with `in` are meaningful as items.
+func isForLambda(p ParseNode) bool {
+	for _, kid := range p.Kids {
+		if kid.Token.Kind == TokenIn {
+			return false
+		}
+	}
+	return true
+}
+
+// Normalizes lambda shorthand as an anonymous fun with an optional param.
+func (b *treeBuilder) normForLambda(p ParseNode) {
+	fun := inFun{}
+	next := p.ExpectToken(0, TokenFor)
+	next, part := p.Next(next)
+	start := len(b.work)
+	if part.Token.Kind == TokenId {
+		b.pushWork(inNode{kind: NodeVar, index: len(b.vars)})
+		b.vars = append(b.vars, inVar{Def: Def{Name: part.Token.Text}})
+		next, part = p.Next(next)
+	}
+	b.commitBlock(start)
+	fun.params = b.popWorkBlock()
+	b.normFunBody(&fun, p, next, part)
+}
+
 func (b *treeBuilder) normFun(p ParseNode) {
 	fun := inFun{}
 	next := p.ExpectToken(0, TokenFun)
 	next, part := p.Next(next)
+	start := len(b.work)
 	if part.Token.Kind == TokenId {
 		fun.Name = part.Token.Text
+		receiver := part
 		next, part = p.Next(next)
+		if part.Kind == ParseList {
+			fun.typeParams = b.normTypeParams(part)
+			next, part = p.Next(next)
+		}
+		selfFlags := NodeFlagNone
+		if part.Token.Kind == TokenAmp {
+			// Only `&` methods can change self, as in `fun Stack&.push(...)`.
+			selfFlags = NodeFlagChange
+			next, part = p.Next(next)
+		}
+		if part.Token.Kind == TokenDot {
+			// Methods get their receiver as a leading self param.
+			fun.receiver = b.normNodeCommit(receiver)
+			b.pushWork(inNode{kind: NodeVar, index: len(b.vars)})
+			b.vars = append(b.vars, inVar{
+				Def: Def{Name: "self", Flags: selfFlags}, typ: fun.receiver,
+			})
+			next, part = p.Next(next)
+			fun.Name = part.Token.Text
+			next, part = p.Next(next)
+		}
 	} else {
 		fun.Name = ""
 	}
 	if part.Kind == ParseParams {
-		b.normParams(part)
-		fun.params = b.popWorkBlock()
+		b.normParamItems(part)
 		next, part = p.Next(next)
 	}
+	b.commitBlock(start)
+	fun.params = b.popWorkBlock()
 	// TODO Return type.
-	if part.Kind == ParseBlock {
+	b.normFunBody(&fun, p, next, part)
+	// log.Printf("fun %s %v\n", fun.Name, fun.params)
+}
+
+func (b *treeBuilder) normFunType(p ParseNode) {
+	f := inFunSpec{}
+	next := p.ExpectToken(0, TokenFun)
+	next, part := p.Next(next)
+	start := len(b.work)
+	if part.Token.Kind == TokenRoundOpen {
+		part, next = b.normItems(p, next)
+		if part.Token.Kind != TokenRoundClose {
+			// log.Printf("Unexpected: %v\n", part)
+		}
+		next, part = p.Next(next)
+	}
+	b.commitBlock(start)
+	f.params = b.popWorkBlock()
+	if part.Kind != ParseNone {
+		f.ret = b.normNodeCommit(part)
+		_, part = p.Next(next)
+	}
+	b.expectNone(part)
+	b.pushWork(inNode{kind: NodeFunSpec, index: len(b.funSpecs)})
+	b.funSpecs = append(b.funSpecs, f)
+}
+
+// Normalizes the body starting at part and pushes the fun.
+func (b *treeBuilder) normFunBody(
+	fun *inFun, p ParseNode, next int, part ParseNode,
+) {
+	switch {
+	case part.Kind == ParseBlock:
 		b.normBlock(part)
 		fun.kids = b.popWorkBlock()
 		_, part = p.Next(next)
+	case part.Token.Kind == TokenThen:
+		// Inline bodies, as in `fun(x) then x + 1`, return their value.
+		next, part = p.Next(next)
+		start := len(b.work)
+		value := b.normNodeCommit(part)
+		b.pushWork(inNode{kind: NodeReturn, index: len(b.returns)})
+		b.returns = append(b.returns, inReturn{kind: TokenReturn, value: value})
+		b.commitBlock(start)
+		fun.kids = b.popWorkBlock()
+		_, part = p.Next(next)
 	}
 	b.expectNone(part)
 	b.pushWork(inNode{kind: NodeFun, index: len(b.funs)})
-	b.funs = append(b.funs, fun)
-	// log.Printf("fun %s %v\n", fun.Name, fun.params)
+	b.funs = append(b.funs, *fun)
 }
 
-func (b *treeBuilder) normInfix(p ParseNode) {
+func (b *treeBuilder) normGet(p ParseNode) {
 	start := len(b.work)
-	call := inCall{}
-	// Call a get node.
 	get := inGet{}
+	next, part := p.Next(0)
+	get.subject = b.normNodeCommit(part)
+	next = p.ExpectToken(next, TokenDot)
+	next, part = p.Next(next)
+	get.member = b.normNodeCommit(part)
+	_, part = p.Next(next)
+	b.expectNone(part)
+	b.commit(inNode{kind: NodeGet, index: len(b.gets)}, start)
+	b.gets = append(b.gets, get)
+}
+
+// Normalizes an if chain into a subjectless switch with one case per branch.
+func (b *treeBuilder) normIf(p ParseNode) {
+	s := inSwitch{}
+	start := len(b.work)
+	b.normIfCases(p)
+	b.commitBlock(start)
+	s.kids = b.popWorkBlock()
+	b.pushWork(inNode{kind: NodeSwitch, index: len(b.switches)})
+	b.switches = append(b.switches, s)
+}
+
+func (b *treeBuilder) normIfCases(p ParseNode) {
+	c := inCase{}
+	next := p.ExpectToken(0, TokenIf)
+	next, part := p.Next(next)
+	start := len(b.work)
+	b.normNode(part)
+	b.commitBlock(start)
+	c.patterns = b.popWorkBlock()
+	next, part = p.Next(next)
+	if part.Kind == ParseBlock {
+		b.normBlock(part)
+		c.kids = b.popWorkBlock()
+		next, part = p.Next(next)
+	}
+	b.pushWork(inNode{kind: NodeCase, index: len(b.cases)})
+	b.cases = append(b.cases, c)
+	if part.Token.Kind == TokenElse {
+		next, part = p.Next(next)
+		switch part.Kind {
+		case ParseIf:
+			b.normIfCases(part)
+			next, part = p.Next(next)
+		case ParseBlock:
+			c := inCase{always: true}
+			b.normBlock(part)
+			c.kids = b.popWorkBlock()
+			b.pushWork(inNode{kind: NodeCase, index: len(b.cases)})
+			b.cases = append(b.cases, c)
+			next, part = p.Next(next)
+		}
+	}
+	if part.Token.Kind == TokenEnd {
+		_, part = p.Next(next)
+	}
+	b.expectNone(part)
+}
+
+// Normalizes indexing into a get method call, as in `xs.get(i)`.
+func (b *treeBuilder) normImport(p ParseNode) {
+	imp := inImport{}
+	next, part := p.Next(0)
+	from := part.Token.Kind == TokenFrom
+	next, part = p.Next(next)
+	switch {
+	case part.Kind == ParseString:
+		imp.path = stringText(part)
+		// Qualified by file name by default.
+		imp.Name = path.Base(strings.TrimSuffix(imp.path, ".rio"))
+		next, part = p.Next(next)
+	case from && part.Token.Kind == TokenId:
+		imp.from = b.normNodeCommit(part)
+		next, part = p.Next(next)
+	}
+	if part.Token.Kind == TokenAs {
+		next, part = p.Next(next)
+		if part.Token.Kind == TokenId {
+			imp.Name = part.Token.Text
+			next, part = p.Next(next)
+		}
+	}
+	if part.Kind == ParseUse {
+		alias := false
+		for _, kid := range part.Kids {
+			switch kid.Token.Kind {
+			case TokenAs:
+				alias = len(imp.uses) > 0
+			case TokenId:
+				switch {
+				case alias:
+					imp.uses[len(imp.uses)-1].Alias = kid.Token.Text
+					alias = false
+				default:
+					name := kid.Token.Text
+					imp.uses = append(imp.uses, Use{Name: name, Alias: name})
+				}
+			}
+		}
+		_, part = p.Next(next)
+	}
+	b.expectNone(part)
+	b.pushWork(inNode{kind: NodeImport, index: len(b.imports)})
+	b.imports = append(b.imports, imp)
+}
+
+func (b *treeBuilder) normIndex(p ParseNode) {
 	next, subject := p.Next(0)
+	_, index := p.Next(next)
+	b.normMethodCall(subject, "get", index, nil)
+}
+
+// Normalizes a call of the named method on subject, with args from the items
+// of a list node, plus any extra arg.
+func (b *treeBuilder) normMethodCall(
+	subject ParseNode, name string, args ParseNode, extra func(),
+) {
+	start := len(b.work)
+	call := inCall{}
+	get := inGet{}
 	get.subject = b.normNodeCommit(subject)
+	b.pushWork(inNode{kind: NodeRef, index: len(b.refs)})
+	b.refs = append(b.refs, name)
+	b.commitHeadless(start)
+	get.member = Idx[inNode](len(b.nodes) - 1)
+	b.commit(inNode{kind: NodeGet, index: len(b.gets)}, start)
+	b.gets = append(b.gets, get)
+	b.commitHeadless(start)
+	call.callee = Idx[inNode](len(b.nodes) - 1)
+	b.normItems(args, args.ExpectToken(0, TokenSquareOpen))
+	if extra != nil {
+		extra()
+	}
+	b.commitBlock(start)
+	call.args = b.popWorkBlock()
+	b.commit(inNode{kind: NodeCall, index: len(b.calls)}, start)
+	b.calls = append(b.calls, call)
+}
+
+// Operator method names, including for compound assignment.
+var opMethods = map[TokenKind]string{
+	TokenAdd:       "add",
+	TokenAddEq:     "add",
+	TokenEqEq:      "eq",
+	TokenGe:        "ge",
+	TokenGt:        "gt",
+	TokenLe:        "le",
+	TokenLt:        "lt",
+	TokenPercent:   "mod",
+	TokenPercentEq: "mod",
+	TokenSlash:     "div",
+	TokenSlashEq:   "div",
+	TokenStar:      "mul",
+	TokenStarEq:    "mul",
+	TokenSub:       "sub",
+	TokenSubEq:     "sub",
+}
+
+func (b *treeBuilder) normInfix(p ParseNode) {
+	next, subject := p.Next(0)
 	next, op := p.Next(next)
-	// Make a token for an operator method name.
-	name := ""
+	_, other := p.Next(next)
 	switch op.Token.Kind {
-	case TokenAdd:
-		name = "add"
-	case TokenEqEq:
-		name = "eq"
-	case TokenGt:
-		name = "gt"
-	case TokenLt:
-		name = "lt"
-	case TokenSub:
-		name = "sub"
+	case TokenAnd, TokenOr:
+		b.normLogic(p, op.Token.Kind)
+	case TokenAs, TokenIs:
+		c := inCast{kind: op.Token.Kind}
+		c.subject = b.normNodeCommit(subject)
+		c.spec = b.normNodeCommit(other)
+		b.pushWork(inNode{kind: NodeCast, index: len(b.casts)})
+		b.casts = append(b.casts, c)
+	case TokenNEq:
+		// Negate eq, as in `not a == b`.
+		start := len(b.work)
+		b.normOpCall(subject, "eq", other)
+		b.pushLogic(TokenNot, start)
+	default:
+		b.normOpCall(subject, opMethods[op.Token.Kind], other)
+	}
+}
+
+// Calls the operator method named on subject, with other as the arg.
+func (b *treeBuilder) normOpCall(
+	subject ParseNode, name string, other ParseNode,
+) {
+	start := len(b.work)
+	b.normNode(subject)
+	b.pushOpCall(start, name, func() { b.normNode(other) })
+}
+
+// Calls the operator method named on any subject already in work from start,
+// with the arg from other.
+func (b *treeBuilder) pushOpCall(start int, name string, other func()) {
+	call := inCall{}
+	// Call a get node.
+	get := inGet{}
+	if len(b.work) > start {
+		b.commitHeadless(start)
+		get.subject = Idx[inNode](len(b.nodes) - 1)
 	}
 	if name != "" {
 		b.pushWork(inNode{kind: NodeRef, index: len(b.refs)})
@@ -229,8 +790,7 @@ func (b *treeBuilder) normInfix(p ParseNode) {
 	b.commitHeadless(start)
 	call.callee = Idx[inNode](len(b.nodes) - 1)
 	// Get the other operand as a method arg.
-	_, other := p.Next(next)
-	b.normNode(other)
+	other()
 	b.commitBlock(start)
 	call.args = b.popWorkBlock()
 	// Finish.
@@ -242,6 +802,59 @@ func (b *treeBuilder) normJunk(p ParseNode) {
 	// panic("unimplemented")
 }
 
+func (b *treeBuilder) normLabel(p ParseNode) {
+	next, label := p.Next(0)
+	next = p.ExpectToken(next, TokenColon)
+	start := len(b.work)
+	_, part := p.Next(next)
+	b.normNode(part)
+	if len(b.work) > start {
+		w := b.work[len(b.work)-1]
+		switch w.kind {
+		case NodeFor:
+			b.fors[w.index].Name = label.Token.Text
+		}
+	}
+}
+
+func (b *treeBuilder) normList(p ParseNode) {
+	next := p.ExpectToken(0, TokenSquareOpen)
+	start := len(b.work)
+	part, next := b.normItems(p, next)
+	b.commitBlock(start)
+	if part.Token.Kind != TokenSquareClose {
+		// log.Printf("Unexpected: %v\n", part)
+	}
+	_, part = p.Next(next)
+	b.expectNone(part)
+	b.pushListWork()
+}
+
+// Pushes a list of the latest work block.
+func (b *treeBuilder) pushListWork() {
+	l := inList{items: b.popWorkBlock()}
+	b.pushWork(inNode{kind: NodeList, index: len(b.lists)})
+	b.lists = append(b.lists, l)
+}
+
+// Operands of logic nodes run only as needed, so they aren't method calls.
+func (b *treeBuilder) normLogic(p ParseNode, kind TokenKind) {
+	start := len(b.work)
+	next, left := p.Next(0)
+	b.normNode(left)
+	next = p.ExpectToken(next, kind)
+	_, right := p.Next(next)
+	b.normNode(right)
+	b.pushLogic(kind, start)
+}
+
+func (b *treeBuilder) pushLogic(kind TokenKind, start int) {
+	b.commitBlock(start)
+	l := inLogic{kind: kind, args: b.popWorkBlock()}
+	b.pushWork(inNode{kind: NodeLogic, index: len(b.logics)})
+	b.logics = append(b.logics, l)
+}
+
 func (b *treeBuilder) normModify(p ParseNode) {
 	next := 0
 	part := ParseNode{}
@@ -250,6 +863,8 @@ Modify:
 	for {
 		next, part = p.Next(next)
 		switch part.Token.Kind {
+		case TokenChange:
+			flags |= NodeFlagChange
 		case TokenPlug:
 			flags |= NodeFlagPlug
 		case TokenPub:
@@ -265,6 +880,8 @@ Modify:
 	switch w.kind {
 	case NodeFun:
 		b.funs[w.index].Flags |= flags
+	case NodeRecord:
+		b.records[w.index].Flags |= flags
 	case NodeVar:
 		b.vars[w.index].Flags |= flags
 	}
@@ -280,13 +897,33 @@ func (b *treeBuilder) normNone(p ParseNode) {
 }
 
 func (b *treeBuilder) normParam(p ParseNode) {
-	// No var keyword here.
-	// TODO Just check for one anyway?
+	switch _, part := p.Next(0); part.Kind {
+	case ParseModify, ParseVar:
+		// Marks a field for class params.
+		b.normNode(part)
+		b.vars[len(b.vars)-1].Flags |= NodeFlagField
+		return
+	}
 	b.normVarFinish(p, 0)
 }
 
+// Normalizes params that are all fields, as for structs and union variants.
+func (b *treeBuilder) normFieldParams(p ParseNode) Range[inNode] {
+	varsStart := len(b.vars)
+	b.normParams(p)
+	for i := varsStart; i < len(b.vars); i++ {
+		b.vars[i].Flags |= NodeFlagField
+	}
+	return b.popWorkBlock()
+}
+
 func (b *treeBuilder) normParams(p ParseNode) {
 	start := len(b.work)
+	b.normParamItems(p)
+	b.commitBlock(start)
+}
+
+func (b *treeBuilder) normParamItems(p ParseNode) {
 	next := p.ExpectToken(0, TokenRoundOpen)
 	part := ParseNode{}
 Params:
@@ -309,15 +946,36 @@ Params:
 	}
 	_, part = p.Next(next)
 	b.expectNone(part)
-	b.commitBlock(start)
 }
 
 func (b *treeBuilder) normPrefix(p ParseNode) {
 	next, prefix := p.Next(0)
 	_, node := p.Next(next)
 	switch prefix.Token.Kind {
+	case TokenNot:
+		start := len(b.work)
+		b.normNode(node)
+		b.pushLogic(TokenNot, start)
+		return
+	case TokenQuestion:
+		// Optional type, as in `?Int`.
+		m := inMaybe{}
+		m.item = b.normNodeCommit(node)
+		b.pushWork(inNode{kind: NodeMaybe, index: len(b.maybes)})
+		b.maybes = append(b.maybes, m)
+		return
+	case TokenStar:
+		// List type, as in `*Int`, which works like `[Int]` as a type.
+		start := len(b.work)
+		b.normNode(node)
+		b.commitBlock(start)
+		b.pushListWork()
+		return
 	case TokenSub:
 		switch node.Token.Kind {
+		case TokenFloat:
+			b.normTokenFloat(node, -1)
+			return
 		case TokenInt:
 			b.normTokenInt(node, -1)
 			return
@@ -330,42 +988,188 @@ func (b *treeBuilder) normPrefix(p ParseNode) {
 
 func (b *treeBuilder) normReturn(p ParseNode) {
 	r := inReturn{}
-	next := p.ExpectToken(0, TokenReturn)
-	_, part := p.Next(next)
-	r.kind = TokenReturn
+	next, part := p.Next(0)
+	r.kind = part.Token.Kind
+	_, part = p.Next(next)
+	if part.Kind == ParseLabel {
+		// Leave the label as a ref for the resolver to find.
+		next, label := part.Next(0)
+		r.label = b.normNodeCommit(label)
+		next = part.ExpectToken(next, TokenColon)
+		_, part = part.Next(next)
+	}
 	r.value = b.normNodeCommit(part)
 	b.pushWork(inNode{kind: NodeReturn, index: len(b.returns)})
 	b.returns = append(b.returns, r)
 }
 
+// Interpolated strings add str calls on each expr to the text around them, as
+// in `"x = ".add(str(x))`.
 func (b *treeBuilder) normString(p ParseNode) {
+	start := len(b.work)
+	// Adds to whatever's already in work.
+	piece := func(norm func()) {
+		switch len(b.work) {
+		case start:
+			norm()
+		default:
+			b.pushOpCall(start, "add", norm)
+		}
+	}
+	pushText := func(text string) {
+		b.pushWork(inNode{kind: NodeValue, index: len(b.values)})
+		b.values = append(b.values, text)
+	}
 	builder := strings.Builder{}
+	var problems []string
 	next := p.ExpectToken(0, TokenStringOpen)
 	part := ParseNode{}
 Parts:
 	for {
 		next, part = p.Next(next)
 		switch part.Token.Kind {
-		case TokenStringText:
-			builder.WriteString(part.Token.Text)
-		case TokenStringEscape:
-			// TODO Multi-rune escapes.
-			switch r := RuneAt(part.Token.Text, 1); r {
-			case '"', '\\':
-				builder.WriteRune(r)
-			case 'n':
-				builder.WriteRune('\n')
-			case 'r':
-				builder.WriteRune('\r')
-			case 't':
-				builder.WriteRune('\t')
+		case TokenStringExprOpen:
+			if text := builder.String(); text != "" {
+				piece(func() { pushText(text) })
+				builder.Reset()
 			}
+			next, part = p.Next(next)
+			if part.Token.Kind == TokenStringExprClose {
+				// Nothing to interpolate, as in `"\()"`.
+				problems = append(problems, "bad interpolation")
+				continue Parts
+			}
+			after, closer := p.Next(next)
+			if isIncomplete(part) || closer.Token.Kind != TokenStringExprClose {
+				// Skip past the expr but keep any text after.
+				problems = append(problems, "bad interpolation")
+				for closer.Kind != ParseNone && closer.Token.Kind != TokenStringExprClose {
+					after, closer = p.Next(after)
+				}
+				next = after
+				continue Parts
+			}
+			piece(func() { b.pushStrCall(part) })
+			next = after
 		case TokenStringClose, TokenNone:
 			break Parts
+		default:
+			if !writeStringPart(&builder, part) {
+				problems = append(problems, "bad code point: "+part.Token.Text)
+			}
 		}
 	}
-	b.pushWork(inNode{kind: NodeValue, index: len(b.values)})
-	b.values = append(b.values, builder.String())
+	if text := builder.String(); text != "" || len(b.work) == start {
+		piece(func() { pushText(text) })
+	}
+	for _, problem := range problems {
+		b.problems = append(b.problems, inProblem{*last(&b.work), problem})
+	}
+}
+
+// Says whether an expr is missing parts, as in `1 +`.
+func isIncomplete(p ParseNode) bool {
+	switch p.Kind {
+	case ParseInfix:
+		next, _ := p.Next(0)
+		next, _ = p.Next(next)
+		if _, other := p.Next(next); other.Kind == ParseNone {
+			return true
+		}
+	case ParseJunk:
+		return true
+	}
+	return slices.ContainsFunc(p.Kids, isIncomplete)
+}
+
+func (b *treeBuilder) pushStrCall(expr ParseNode) {
+	start := len(b.work)
+	call := inCall{}
+	b.pushWork(inNode{kind: NodeRef, index: len(b.refs)})
+	b.refs = append(b.refs, "str")
+	b.commitHeadless(start)
+	call.callee = Idx[inNode](len(b.nodes) - 1)
+	b.normNode(expr)
+	b.commitBlock(start)
+	call.args = b.popWorkBlock()
+	b.commit(inNode{kind: NodeCall, index: len(b.calls)}, start)
+	b.calls = append(b.calls, call)
+}
+
+func stringText(p ParseNode) string {
+	builder := strings.Builder{}
+	next := p.ExpectToken(0, TokenStringOpen)
+	part := ParseNode{}
+Parts:
+	for {
+		next, part = p.Next(next)
+		switch part.Token.Kind {
+		case TokenStringClose, TokenNone:
+			break Parts
+		default:
+			writeStringPart(&builder, part)
+		}
+	}
+	return builder.String()
+}
+
+// Writes text or an escape, ignoring anything else, and says whether any
+// escape was valid.
+func writeStringPart(builder *strings.Builder, part ParseNode) bool {
+	switch part.Token.Kind {
+	case TokenStringText:
+		builder.WriteString(part.Token.Text)
+	case TokenStringEscape:
+		switch r := RuneAt(part.Token.Text, 1); r {
+		case '"', '\\':
+			builder.WriteRune(r)
+		case 'n':
+			builder.WriteRune('\n')
+		case 'r':
+			builder.WriteRune('\r')
+		case 't':
+			builder.WriteRune('\t')
+		case 'u':
+			text := strings.TrimPrefix(part.Token.Text, "\\u(")
+			code, err := strconv.ParseUint(strings.TrimSuffix(text, ")"), 16, 32)
+			if err != nil || !utf8.ValidRune(rune(code)) {
+				builder.WriteRune(utf8.RuneError)
+				return false
+			}
+			builder.WriteRune(rune(code))
+		}
+	}
+	return true
+}
+
+func (b *treeBuilder) normStruct(p ParseNode) {
+	r := inRecord{kind: TokenStruct}
+	next := p.ExpectToken(0, TokenStruct)
+	next, part := p.Next(next)
+	if part.Token.Kind == TokenId {
+		r.Name = part.Token.Text
+		next, part = p.Next(next)
+	}
+	if part.Kind == ParseList {
+		r.typeParams = b.normTypeParams(part)
+		next, part = p.Next(next)
+	}
+	if part.Kind == ParseParams {
+		r.params = b.normFieldParams(part)
+		next, part = p.Next(next)
+	}
+	if part.Kind == ParseBlock {
+		// Field lines are params in form, so normBlock handles them.
+		b.normBlock(part)
+		r.kids = b.popWorkBlock()
+		next, part = p.Next(next)
+	}
+	if part.Token.Kind == TokenStruct {
+		_, part = p.Next(next)
+	}
+	b.expectNone(part)
+	b.pushWork(inNode{kind: NodeRecord, index: len(b.records)})
+	b.records = append(b.records, r)
 }
 
 func (b *treeBuilder) normSwitch(p ParseNode) {
@@ -374,7 +1178,7 @@ func (b *treeBuilder) normSwitch(p ParseNode) {
 	next, part := p.Next(next)
 	switch p.Kind {
 	case ParseSwitch:
-		b.normNode(part)
+		s.subject = b.normNodeCommit(part)
 		next, part = p.Next(next)
 	case ParseSwitchEmpty:
 		// No subject expected here.
@@ -409,11 +1213,27 @@ func (b *treeBuilder) normToken(p ParseNode) {
 	case TokenId:
 		b.pushWork(inNode{kind: NodeRef, index: len(b.refs)})
 		b.refs = append(b.refs, p.Token.Text)
+	case TokenFalse, TokenTrue:
+		b.pushWork(inNode{kind: NodeValue, index: len(b.values)})
+		b.values = append(b.values, p.Token.Kind == TokenTrue)
+	case TokenFloat:
+		b.normTokenFloat(p, 1)
 	case TokenInt:
 		b.normTokenInt(p, 1)
 	}
 }
 
+func (b *treeBuilder) normTokenFloat(p ParseNode, scale float64) {
+	x, err := strconv.ParseFloat(p.Token.Text, 64)
+	b.pushWork(inNode{kind: NodeValue, index: len(b.values)})
+	b.values = append(b.values, x*scale)
+	if err != nil {
+		b.problems = append(b.problems, inProblem{
+			*last(&b.work), "bad number: " + p.Token.Text,
+		})
+	}
+}
+
 func (b *treeBuilder) normTokenInt(p ParseNode, scale int32) {
 	// TODO Custom int parsing maybe.
 	i, err := strconv.ParseInt(p.Token.Text, 10, 32)
@@ -424,9 +1244,116 @@ func (b *treeBuilder) normTokenInt(p ParseNode, scale int32) {
 	b.values = append(b.values, int32(i)*scale)
 }
 
+// Normalizes type params, as in `[T, R]`, which are only names.
+func (b *treeBuilder) normTypeParams(p ParseNode) Range[inNode] {
+	start := len(b.work)
+	next := p.ExpectToken(0, TokenSquareOpen)
+Params:
+	for {
+		var part ParseNode
+		next, part = p.Next(next)
+		switch part.Token.Kind {
+		case TokenComma:
+		case TokenId:
+			b.pushWork(inNode{kind: NodeTypeParam, index: len(b.typeParams)})
+			b.typeParams = append(b.typeParams, part.Token.Text)
+		default:
+			break Params
+		}
+	}
+	b.commitBlock(start)
+	return b.popWorkBlock()
+}
+
+func (b *treeBuilder) normTry(p ParseNode) {
+	t := inTry{}
+	next := p.ExpectToken(0, TokenTry)
+	next, part := p.Next(next)
+	t.subject = b.normNodeCommit(part)
+	next, part = p.Next(next)
+	if part.Token.Kind == TokenCatch {
+		t.handled = true
+		next, part = p.Next(next)
+		if part.Token.Kind == TokenId {
+			start := len(b.work)
+			b.pushWork(inNode{kind: NodeVar, index: len(b.vars)})
+			b.vars = append(b.vars, inVar{Def: Def{Name: part.Token.Text}})
+			b.commitHeadless(start)
+			t.error = Idx[inNode](len(b.nodes) - 1)
+			next, part = p.Next(next)
+		}
+		if part.Token.Kind == TokenThen {
+			next, part = p.Next(next)
+		}
+		switch part.Kind {
+		case ParseBlock:
+			b.normBlock(part)
+		default:
+			// Inline handler.
+			start := len(b.work)
+			b.normNode(part)
+			b.commitBlock(start)
+		}
+		t.kids = b.popWorkBlock()
+		_, part = p.Next(next)
+	}
+	b.expectNone(part)
+	b.pushWork(inNode{kind: NodeTry, index: len(b.tries)})
+	b.tries = append(b.tries, t)
+}
+
+func (b *treeBuilder) normTuple(p ParseNode) {
+	next := p.ExpectToken(0, TokenRoundOpen)
+	start := len(b.work)
+	_, next = b.normItems(p, next)
+	_, part := p.Next(next)
+	b.expectNone(part)
+	isComma := func(kid ParseNode) bool { return kid.Token.Kind == TokenComma }
+	if len(b.work) == start+1 && !slices.ContainsFunc(p.Kids, isComma) {
+		// Just grouping, as in `(a + b) * c`.
+		return
+	}
+	b.commitBlock(start)
+	t := inTuple{items: b.popWorkBlock()}
+	b.pushWork(inNode{kind: NodeTuple, index: len(b.tuples)})
+	b.tuples = append(b.tuples, t)
+}
+
+// Normalizes `var (a, b) = value`, where only plain names become vars.
+func (b *treeBuilder) normUnpack(p ParseNode, next int) {
+	u := inUnpack{}
+	next, part := p.Next(next)
+	start := len(b.work)
+	for _, item := range part.Kids {
+		if item.Kind == ParseToken && item.Token.Kind == TokenId {
+			b.pushWork(inNode{kind: NodeVar, index: len(b.vars)})
+			b.vars = append(b.vars, inVar{Def: Def{Name: item.Token.Text}})
+		}
+	}
+	b.commitBlock(start)
+	u.vars = b.popWorkBlock()
+	next, part = p.Next(next)
+	if part.Token.Kind == TokenEq {
+		next, part = p.Next(next)
+		u.value = b.normNodeCommit(part)
+		_, part = p.Next(next)
+	}
+	b.expectNone(part)
+	b.pushWork(inNode{kind: NodeUnpack, index: len(b.unpacks)})
+	b.unpacks = append(b.unpacks, u)
+}
+
 func (b *treeBuilder) normVar(p ParseNode) {
-	next := p.ExpectToken(0, TokenVar)
+	next, part := p.Next(0)
+	if _, target := p.Next(next); target.Kind == ParseTuple {
+		b.normUnpack(p, next)
+		return
+	}
 	b.normVarFinish(p, next)
+	if part.Token.Kind == TokenConst {
+		// Consts are vars whose values are evaluated during analysis.
+		b.vars[len(b.vars)-1].Flags |= NodeFlagConst
+	}
 }
 
 func (b *treeBuilder) normVarFinish(p ParseNode, next int) {
@@ -439,6 +1366,11 @@ func (b *treeBuilder) normVarFinish(p ParseNode, next int) {
 	} else {
 		v.Name = ""
 	}
+	if part.Token.Kind == TokenQuestion {
+		// As in `vel?` for struct fields.
+		v.Flags |= NodeFlagOptional
+		next, part = p.Next(next)
+	}
 	if part.Kind != ParseNone && part.Token.Kind != TokenEq {
 		v.typ = b.normNodeCommit(part)
 		next, part = p.Next(next)
@@ -453,3 +1385,28 @@ func (b *treeBuilder) normVarFinish(p ParseNode, next int) {
 	b.vars = append(b.vars, v)
 	// fmt.Printf("v: %+v\n", v)
 }
+
+func (b *treeBuilder) normVartype(p ParseNode) {
+	v := inVartype{}
+	next := p.ExpectToken(0, TokenVartype)
+	start := len(b.work)
+	next, part := p.Next(next)
+	switch part.Kind {
+	case ParseBlock:
+		for _, kid := range part.Kids {
+			b.normNode(kid)
+		}
+		next, part = p.Next(next)
+	case ParseParam:
+		b.normNode(part)
+		next, part = p.Next(next)
+	}
+	b.commitBlock(start)
+	v.kids = b.popWorkBlock()
+	if part.Token.Kind == TokenVartype {
+		_, part = p.Next(next)
+	}
+	b.expectNone(part)
+	b.pushWork(inNode{kind: NodeVartype, index: len(b.vartypes)})
+	b.vartypes = append(b.vartypes, v)
+}
@@ -47,14 +47,25 @@ type ParseKind int
 const (
 	ParseNone ParseKind = iota
 	ParseArgs
+	ParseAssign
 	ParseBlock
 	ParseCall
 	ParseCase
+	ParseClass
 	ParseComment
 	ParseElse
+	ParseEnum
+	ParseFor
 	ParseFun
+	ParseFunType
+	ParseGet
+	ParseIf
+	ParseImport
+	ParseIndex
 	ParseInfix
 	ParseJunk
+	ParseLabel
+	ParseList
 	ParseModify
 	ParseParam
 	ParseParams
@@ -62,9 +73,14 @@ const (
 	ParseReturn
 	ParseString
 	ParseSwitch
+	ParseStruct
 	ParseSwitchEmpty
 	ParseToken
+	ParseTry
+	ParseTuple
+	ParseUse
 	ParseVar
+	ParseVartype
 )
 
 //go:generate stringer -type=ParseKind
@@ -188,6 +204,18 @@ func (p *parser) peek() (t Token) {
 	return
 }
 
+// Peeks past any vertical space without consuming it.
+func (p *parser) peekPastVSpace() (t Token) {
+	for i := p.index; i < len(p.tokens); i++ {
+		switch t := p.tokens[i]; t.Kind {
+		case TokenCommentOpen, TokenCommentText, TokenHSpace, TokenVSpace:
+		default:
+			return t
+		}
+	}
+	return
+}
+
 func (p *parser) push(node inParseNode) {
 	p.work = append(p.work, node)
 }
@@ -218,10 +246,41 @@ Params:
 
 func (p *parser) parseAdd() {
 	start := len(p.work)
-	p.parseCall()
+	p.parseMul()
 	for {
 		switch t := p.peek(); t.Kind {
 		case TokenAdd, TokenSub:
+			p.pushToken(t)
+			p.parseMul()
+			p.commit(ParseInfix, start)
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) parseAnd() {
+	start := len(p.work)
+	p.parseNot()
+	for {
+		switch t := p.peek(); t.Kind {
+		case TokenAnd:
+			p.pushToken(t)
+			p.parseNot()
+			p.commit(ParseInfix, start)
+		default:
+			return
+		}
+	}
+}
+
+// Binds tighter than math, as in `x as Int + 1`.
+func (p *parser) parseAs() {
+	start := len(p.work)
+	p.parseCall()
+	for {
+		switch t := p.peek(); t.Kind {
+		case TokenAs:
 			p.pushToken(t)
 			p.parseCall()
 			p.commit(ParseInfix, start)
@@ -231,6 +290,18 @@ func (p *parser) parseAdd() {
 	}
 }
 
+func (p *parser) parseAssign() {
+	start := len(p.work)
+	p.parseOr()
+	switch t := p.peek(); t.Kind {
+	case TokenAddEq, TokenEq, TokenPercentEq, TokenSlashEq, TokenStarEq,
+		TokenSubEq:
+		p.pushToken(t)
+		p.parseAssign()
+		p.commit(ParseAssign, start)
+	}
+}
+
 func (p *parser) parseAtom() {
 	if !p.has() {
 		return
@@ -238,25 +309,56 @@ func (p *parser) parseAtom() {
 	switch t := p.peek(); t.Kind {
 	case TokenCase:
 		p.parseCase(t)
+	case TokenClass:
+		p.parseClass(t)
 	case TokenElse:
 		p.parseElse(t)
+	case TokenEnum:
+		p.parseEnum(t)
+	case TokenFor:
+		p.parseFor(t)
+	case TokenFrom:
+		p.parseImport(t)
 	case TokenFun:
 		p.parseFun(t)
-	case TokenId, TokenInt:
+	case TokenIf:
+		p.parseIf(t)
+	case TokenImport:
+		p.parseImport(t)
+	case TokenId:
+		start := len(p.work)
+		p.pushToken(t)
+		if t := p.peek(); t.Kind == TokenColon {
+			p.parseLabel(t, start)
+		}
+	case TokenFalse, TokenFloat, TokenInt, TokenTrue:
 		p.pushToken(t)
-	case TokenPlug, TokenPub:
+	case TokenChange, TokenPlug, TokenPub:
 		p.parseModify(t)
-	case TokenReturn:
+	case TokenBreak, TokenContinue, TokenReturn, TokenYield:
 		p.parseReturn(t)
+	case TokenQuestion, TokenStar, TokenSub:
+		p.parsePrefix(t)
+	case TokenRoundOpen:
+		p.parseTuple()
+	case TokenSquareOpen:
+		p.parseList()
 	case TokenStringOpen:
 		p.parseString(t)
-	case TokenSub:
-		p.parsePrefix(t)
+	case TokenStruct:
+		p.parseStruct(t)
 	case TokenSwitch:
 		p.parseSwitch(t)
-	case TokenVar:
+	case TokenTry:
+		p.parseTry(t)
+	case TokenUnion:
+		p.parseEnum(t)
+	case TokenConst, TokenVar:
 		p.parseVar(t)
-	case TokenVSpace:
+	case TokenVartype:
+		p.parseVartype(t)
+	case TokenStringExprClose, TokenVSpace:
+		// Left for whatever expects it.
 	default:
 		start := len(p.work)
 		p.pushToken(t)
@@ -305,32 +407,59 @@ func (p *parser) parseBlockTop() {
 func (p *parser) parseCall() {
 	start := len(p.work)
 	p.parseAtom()
-	if p.peek().Kind == TokenRoundOpen {
-		p.parseArgs()
-		p.commit(ParseCall, start)
+	for {
+		switch t := p.peek(); t.Kind {
+		case TokenDot:
+			p.pushToken(t)
+			if t := p.peek(); t.Kind == TokenId {
+				p.pushToken(t)
+			}
+			p.commit(ParseGet, start)
+		case TokenRoundOpen:
+			p.parseArgs()
+			p.commit(ParseCall, start)
+		case TokenSquareOpen:
+			p.parseList()
+			p.commit(ParseIndex, start)
+		default:
+			return
+		}
 	}
 }
 
 func (p *parser) parseCase(t Token) {
 	start := len(p.work)
 	p.pushToken(t)
-	// Patterns.
+	// Patterns, as in `case 1, 2`.
 	patternsStart := len(p.work)
-	p.parseExpr()
-	// TODO Multiple patterns separated by comma.
+	for {
+		p.parseExpr()
+		t := p.peek()
+		if t.Kind != TokenComma {
+			break
+		}
+		p.pushToken(t)
+	}
 	p.commit(ParseArgs, patternsStart)
+	// Guard, as in `case Circle(var r) if r > 1`.
+	if t := p.peek(); t.Kind == TokenIf {
+		p.pushToken(t)
+		p.parseExpr()
+	}
 	// Finish.
 	p.parseCaseFinish()
 	p.commit(ParseCase, start)
 }
 
-func (p *parser) parseCaseFinish() {
+// Returns true for a multiline block rather than an inline expression.
+func (p *parser) parseCaseFinish() (block bool) {
 	start := len(p.work)
 	if t := p.peek(); t.Kind == TokenThen {
 		p.pushToken(t)
 	}
 	switch t := p.peek(); t.Kind {
 	case TokenVSpace:
+		block = true
 	Block:
 		for p.has() {
 			switch t := p.peek(); t.Kind {
@@ -346,6 +475,27 @@ func (p *parser) parseCaseFinish() {
 		p.parseExpr()
 	}
 	p.commit(ParseBlock, start)
+	return
+}
+
+func (p *parser) parseClass(t Token) {
+	start := len(p.work)
+	p.pushToken(t)
+	p.parseRecordName()
+	if p.peek().Kind == TokenRoundOpen {
+		p.parseParams()
+	}
+	switch t := p.peek(); t.Kind {
+	case TokenEnd:
+		p.pushToken(t)
+	default:
+		p.parseBlock()
+	}
+	// Allow `end class` for clarity on long classes.
+	if t := p.peek(); t.Kind == TokenClass {
+		p.pushToken(t)
+	}
+	p.commit(ParseClass, start)
 }
 
 func (p *parser) parseCompare() {
@@ -353,7 +503,7 @@ func (p *parser) parseCompare() {
 	p.parseAdd()
 	for {
 		switch t := p.peek(); t.Kind {
-		case TokenEqEq, TokenGe, TokenGt, TokenLe, TokenLt, TokenNEq:
+		case TokenEqEq, TokenGe, TokenGt, TokenIs, TokenLe, TokenLt, TokenNEq:
 			p.pushToken(t)
 			p.parseAdd()
 			p.commit(ParseInfix, start)
@@ -370,8 +520,103 @@ func (p *parser) parseElse(t Token) {
 	p.commit(ParseElse, start)
 }
 
+// Also parses unions, whose members can have payload params.
+func (p *parser) parseEnum(t Token) {
+	start := len(p.work)
+	kind := t.Kind
+	p.pushToken(t)
+	p.parseRecordName()
+	// Member names.
+Members:
+	for p.has() {
+		switch t := p.peek(); t.Kind {
+		case TokenComma, TokenVSpace:
+			p.pushToken(t)
+		case TokenId:
+			p.pushToken(t)
+			if kind == TokenUnion && p.peek().Kind == TokenRoundOpen {
+				p.parseParams()
+			}
+		case TokenEnd:
+			p.pushToken(t)
+			if t := p.peek(); t.Kind == kind {
+				p.pushToken(t)
+			}
+			break Members
+		default:
+			break Members
+		}
+	}
+	p.commit(ParseEnum, start)
+}
+
 func (p *parser) parseExpr() {
-	p.parseCompare()
+	p.parseAssign()
+}
+
+func (p *parser) parseExprIfAny() {
+	switch t := p.peek(); t.Kind {
+	case TokenCase, TokenElse, TokenEnd, TokenNone, TokenRoundClose,
+		TokenStringExprClose, TokenVSpace:
+	default:
+		p.parseExpr()
+	}
+}
+
+// Parses a struct field line, as in `pos ?Vec2`, `vel?`, or `hp Int = 10`.
+func (p *parser) parseField() {
+	start := len(p.work)
+	if t := p.peek(); t.Kind == TokenId {
+		p.pushToken(t)
+		if t := p.peek(); t.Kind == TokenQuestion {
+			p.pushToken(t)
+		}
+	}
+	switch t := p.peek(); t.Kind {
+	case TokenEnd, TokenEq, TokenVSpace:
+	default:
+		p.parseType()
+	}
+	if t := p.peek(); t.Kind == TokenEq {
+		p.pushToken(t)
+		p.parseExpr()
+	}
+	p.commit(ParseParam, start)
+}
+
+// Parses field lines through `end` as a block.
+func (p *parser) parseFields() {
+	start := len(p.work)
+Fields:
+	for p.has() {
+		switch t := p.peek(); t.Kind {
+		case TokenVSpace:
+			p.pushToken(t)
+		case TokenEnd:
+			p.pushToken(t)
+			break Fields
+		default:
+			p.parseField()
+		}
+	}
+	p.commit(ParseBlock, start)
+}
+
+func (p *parser) parseFor(t Token) {
+	start := len(p.work)
+	p.pushToken(t)
+	switch t := p.peek(); t.Kind {
+	case TokenThen, TokenVSpace:
+	default:
+		// Either a condition or an item name for iteration.
+		p.parseExpr()
+		if t := p.peek(); t.Kind == TokenIn {
+			p.pushToken(t)
+			p.parseExpr()
+		}
+	}
+	p.parseBlock()
+	p.commit(ParseFor, start)
 }
 
 func (p *parser) parseFun(t Token) {
@@ -379,6 +624,20 @@ func (p *parser) parseFun(t Token) {
 	p.pushToken(t)
 	if t := p.peek(); t.Kind == TokenId {
 		p.pushToken(t)
+		// Type params, as in `fun first[T]`.
+		if t := p.peek(); t.Kind == TokenSquareOpen {
+			p.parseList()
+		}
+		// Receiver type, as in `fun Something&.blah`.
+		if t := p.peek(); t.Kind == TokenAmp {
+			p.pushToken(t)
+		}
+		if t := p.peek(); t.Kind == TokenDot {
+			p.pushToken(t)
+			if t := p.peek(); t.Kind == TokenId {
+				p.pushToken(t)
+			}
+		}
 	}
 	if p.peek().Kind == TokenRoundOpen {
 		p.parseParams()
@@ -387,6 +646,108 @@ func (p *parser) parseFun(t Token) {
 	p.commit(ParseFun, start)
 }
 
+// Parses fun types, as in `fun(Int, T) R`, with an optional return type.
+func (p *parser) parseFunType(t Token) {
+	start := len(p.work)
+	p.pushToken(t)
+	if t := p.peek(); t.Kind == TokenRoundOpen {
+		p.pushToken(t)
+	Params:
+		for p.has() {
+			switch t := p.peek(); t.Kind {
+			case TokenComma, TokenVSpace:
+				p.pushToken(t)
+			case TokenRoundClose:
+				p.pushToken(t)
+				break Params
+			default:
+				p.parseType()
+			}
+		}
+	}
+	switch t := p.peek(); t.Kind {
+	case TokenFun, TokenId, TokenQuestion, TokenSquareOpen, TokenStar:
+		p.parseType()
+	}
+	p.commit(ParseFunType, start)
+}
+
+func (p *parser) parseIf(t Token) {
+	start := len(p.work)
+	p.pushToken(t)
+	p.parseExpr()
+	block := p.parseCaseFinish()
+	if !block && p.peekPastVSpace().Kind == TokenElse {
+		// Allow inline else on a following line.
+		for t := p.peek(); t.Kind == TokenVSpace; t = p.peek() {
+			p.pushToken(t)
+		}
+	}
+	if t := p.peek(); t.Kind == TokenElse {
+		p.pushToken(t)
+		if t := p.peek(); t.Kind == TokenIf {
+			// The nested if finishes the whole chain, including any end.
+			p.parseIf(t)
+			p.commit(ParseIf, start)
+			return
+		}
+		block = p.parseCaseFinish()
+	}
+	if t := p.peek(); block && t.Kind == TokenEnd {
+		p.pushToken(t)
+	}
+	p.commit(ParseIf, start)
+}
+
+// Parses `import "path" as name use ...` or `from name use ...`.
+func (p *parser) parseImport(t Token) {
+	start := len(p.work)
+	p.pushToken(t)
+	switch t := p.peek(); t.Kind {
+	case TokenId:
+		// Only expected after from.
+		p.pushToken(t)
+	case TokenStringOpen:
+		p.parseString(t)
+	}
+	if t := p.peek(); t.Kind == TokenAs {
+		p.pushToken(t)
+		if t := p.peek(); t.Kind == TokenId {
+			p.pushToken(t)
+		}
+	}
+	if t := p.peek(); t.Kind == TokenUse {
+		p.parseUse(t)
+	}
+	p.commit(ParseImport, start)
+}
+
+// Labels are for loops, but they also target breaks, as in `break outer: 1`.
+func (p *parser) parseLabel(t Token, start int) {
+	p.pushToken(t)
+	p.parseExprIfAny()
+	p.commit(ParseLabel, start)
+}
+
+func (p *parser) parseList() {
+	start := len(p.work)
+	p.pushToken(p.peek())
+Items:
+	for p.has() {
+		t := p.peek()
+		switch t.Kind {
+		case TokenComma, TokenVSpace:
+			p.pushToken(t)
+		case TokenSquareClose:
+			p.pushToken(t)
+			break Items
+		default:
+			p.parseExpr()
+		}
+	}
+	p.commit(ParseList, start)
+}
+
 func (p *parser) parseModify(t Token) {
 	start := len(p.work)
 	p.pushToken(t)
@@ -394,7 +755,7 @@ Mods:
 	for p.has() {
 		t := p.peek()
 		switch t.Kind {
-		case TokenPlug, TokenPub:
+		case TokenChange, TokenPlug, TokenPub:
 		default:
 			break Mods
 		}
@@ -404,18 +765,66 @@ Mods:
 	p.commit(ParseModify, start)
 }
 
+func (p *parser) parseMul() {
+	start := len(p.work)
+	p.parseAs()
+	for {
+		switch t := p.peek(); t.Kind {
+		case TokenPercent, TokenSlash, TokenStar:
+			p.pushToken(t)
+			p.parseAs()
+			p.commit(ParseInfix, start)
+		default:
+			return
+		}
+	}
+}
+
+// Binds looser than compare, as in `not a == b`.
+func (p *parser) parseNot() {
+	switch t := p.peek(); t.Kind {
+	case TokenNot:
+		start := len(p.work)
+		p.pushToken(t)
+		p.parseNot()
+		p.commit(ParsePrefix, start)
+	default:
+		p.parseCompare()
+	}
+}
+
+func (p *parser) parseOr() {
+	start := len(p.work)
+	p.parseAnd()
+	for {
+		switch t := p.peek(); t.Kind {
+		case TokenOr:
+			p.pushToken(t)
+			p.parseAnd()
+			p.commit(ParseInfix, start)
+		default:
+			return
+		}
+	}
+}
+
 func (p *parser) parseParam() {
 	start := len(p.work)
+	// Take the name apart so a type like `*Int` isn't multiplication.
+	if t := p.peek(); t.Kind == TokenId {
+		p.pushToken(t)
+	}
 Param:
 	for p.has() {
 		t := p.peek()
 		switch t.Kind {
 		case TokenComma, TokenRoundClose:
 			break Param
-		case TokenVSpace:
+		case TokenEq, TokenVSpace:
 			p.pushToken(t)
 		default:
-			p.parseExpr()
+			// Leave any `=` for a default value.
+			p.parseType()
 		}
 	}
 	p.commit(ParseParam, start)
@@ -443,18 +852,25 @@ Params:
 func (p *parser) parsePrefix(t Token) {
 	start := len(p.work)
 	p.pushToken(t)
-	p.parseExpr()
+	// Bind tighter than infix, as in `-a + b` or `*Int = []`.
+	p.parseCall()
 	p.commit(ParsePrefix, start)
 }
 
+// Parses any name with type params, as in `Stack[T]`.
+func (p *parser) parseRecordName() {
+	if t := p.peek(); t.Kind == TokenId {
+		p.pushToken(t)
+		if t := p.peek(); t.Kind == TokenSquareOpen {
+			p.parseList()
+		}
+	}
+}
+
 func (p *parser) parseReturn(t Token) {
 	start := len(p.work)
 	p.pushToken(t)
-	switch t := p.peek(); t.Kind {
-	case TokenVSpace:
-	default:
-		p.parseExpr()
-	}
+	p.parseExprIfAny()
 	p.commit(ParseReturn, start)
 }
 
@@ -465,17 +881,44 @@ func (p *parser) parseStatement() {
 func (p *parser) parseString(t Token) {
 	start := len(p.work)
 	p.pushToken(t)
-Params:
+Parts:
 	for p.has() {
 		t := p.peek()
-		p.pushToken(t)
-		if t.Kind == TokenStringClose {
-			break Params
+		switch t.Kind {
+		case TokenStringClose:
+			p.pushToken(t)
+			break Parts
+		case TokenStringExprOpen:
+			// Interpolated, as in `"x = \(x)"`.
+			p.pushToken(t)
+			p.parseExprIfAny()
+			if t := p.peek(); t.Kind == TokenStringExprClose {
+				p.pushToken(t)
+			}
+		case TokenStringEscape, TokenStringText:
+			p.pushToken(t)
+		default:
+			// Unterminated.
+			break Parts
 		}
 	}
 	p.commit(ParseString, start)
 }
 
+func (p *parser) parseStruct(t Token) {
+	start := len(p.work)
+	p.pushToken(t)
+	p.parseRecordName()
+	if p.peek().Kind == TokenRoundOpen {
+		p.parseParams()
+	}
+	p.parseFields()
+	if t := p.peek(); t.Kind == TokenStruct {
+		p.pushToken(t)
+	}
+	p.commit(ParseStruct, start)
+}
+
 func (p *parser) parseSwitch(t Token) {
 	start := len(p.work)
 	kind := ParseSwitch
@@ -490,6 +933,78 @@ func (p *parser) parseSwitch(t Token) {
 	p.commit(kind, start)
 }
 
+// Parses try expressions, as in `try f()` or `try f() catch err then 0`.
+func (p *parser) parseTry(t Token) {
+	start := len(p.work)
+	p.pushToken(t)
+	p.parseExpr()
+	if t := p.peek(); t.Kind == TokenCatch {
+		p.pushToken(t)
+		if t := p.peek(); t.Kind == TokenId {
+			p.pushToken(t)
+		}
+		p.parseBlock()
+	}
+	p.commit(ParseTry, start)
+}
+
+// Parses `(a, b)`, which also serves to group a single item.
+func (p *parser) parseTuple() {
+	start := len(p.work)
+	p.pushToken(p.peek())
+Items:
+	for p.has() {
+		t := p.peek()
+		switch t.Kind {
+		case TokenComma, TokenVSpace:
+			p.pushToken(t)
+		case TokenRoundClose:
+			p.pushToken(t)
+			break Items
+		default:
+			p.parseExpr()
+		}
+	}
+	p.commit(ParseTuple, start)
+}
+
+// Parses names as in `use a, b as c` on one line or else in a block.
+func (p *parser) parseUse(t Token) {
+	start := len(p.work)
+	p.pushToken(t)
+	block := p.peek().Kind == TokenVSpace
+Names:
+	for p.has() {
+		switch t := p.peek(); t.Kind {
+		case TokenAs, TokenComma, TokenId:
+			p.pushToken(t)
+		case TokenVSpace:
+			if !block {
+				break Names
+			}
+			p.pushToken(t)
+		case TokenEnd:
+			if block {
+				p.pushToken(t)
+			}
+			break Names
+		default:
+			break Names
+		}
+	}
+	p.commit(ParseUse, start)
+}
+
+// Parses type specs, which also allow fun types.
+func (p *parser) parseType() {
+	switch t := p.peek(); t.Kind {
+	case TokenFun:
+		p.parseFunType(t)
+	default:
+		p.parseCompare()
+	}
+}
+
 func (p *parser) parseVar(t Token) {
 	start := len(p.work)
 	p.pushToken(t)
@@ -499,19 +1014,34 @@ func (p *parser) parseVar(t Token) {
 	}
 	// Check for type.
 	switch t := p.peek(); t.Kind {
-	case TokenEq:
-	case TokenVSpace:
+	case TokenComma, TokenEq, TokenRoundClose, TokenVSpace:
 	default:
-		// Type.
-		p.parseExpr()
+		// Type, but leave any `=` for init.
+		p.parseType()
 	}
 	// Check for init.
 	if t := p.peek(); t.Kind == TokenEq {
 		p.pushToken(t)
-		if p.peek().Kind == TokenVSpace {
+		if t := p.peek(); t.Kind == TokenVSpace {
 			p.pushToken(t)
 		}
 		p.parseExpr()
 	}
 	p.commit(ParseVar, start)
 }
+
+// Parses either a block of name types or just one, as in `vartype pos Vec2`.
+func (p *parser) parseVartype(t Token) {
+	start := len(p.work)
+	p.pushToken(t)
+	switch t := p.peek(); t.Kind {
+	case TokenVSpace:
+		p.parseFields()
+		if t := p.peek(); t.Kind == TokenVartype {
+			p.pushToken(t)
+		}
+	default:
+		p.parseField()
+	}
+	p.commit(ParseVartype, start)
+}
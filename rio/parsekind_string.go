@@ -10,29 +10,45 @@ func _() {
 	var x [1]struct{}
 	_ = x[ParseNone-0]
 	_ = x[ParseArgs-1]
-	_ = x[ParseBlock-2]
-	_ = x[ParseCall-3]
-	_ = x[ParseCase-4]
-	_ = x[ParseComment-5]
-	_ = x[ParseElse-6]
-	_ = x[ParseFun-7]
-	_ = x[ParseInfix-8]
-	_ = x[ParseJunk-9]
-	_ = x[ParseModify-10]
-	_ = x[ParseParam-11]
-	_ = x[ParseParams-12]
-	_ = x[ParsePrefix-13]
-	_ = x[ParseReturn-14]
-	_ = x[ParseString-15]
-	_ = x[ParseSwitch-16]
-	_ = x[ParseSwitchEmpty-17]
-	_ = x[ParseToken-18]
-	_ = x[ParseVar-19]
+	_ = x[ParseAssign-2]
+	_ = x[ParseBlock-3]
+	_ = x[ParseCall-4]
+	_ = x[ParseCase-5]
+	_ = x[ParseClass-6]
+	_ = x[ParseComment-7]
+	_ = x[ParseElse-8]
+	_ = x[ParseEnum-9]
+	_ = x[ParseFor-10]
+	_ = x[ParseFun-11]
+	_ = x[ParseFunType-12]
+	_ = x[ParseGet-13]
+	_ = x[ParseIf-14]
+	_ = x[ParseImport-15]
+	_ = x[ParseIndex-16]
+	_ = x[ParseInfix-17]
+	_ = x[ParseJunk-18]
+	_ = x[ParseLabel-19]
+	_ = x[ParseList-20]
+	_ = x[ParseModify-21]
+	_ = x[ParseParam-22]
+	_ = x[ParseParams-23]
+	_ = x[ParsePrefix-24]
+	_ = x[ParseReturn-25]
+	_ = x[ParseString-26]
+	_ = x[ParseSwitch-27]
+	_ = x[ParseStruct-28]
+	_ = x[ParseSwitchEmpty-29]
+	_ = x[ParseToken-30]
+	_ = x[ParseTry-31]
+	_ = x[ParseTuple-32]
+	_ = x[ParseUse-33]
+	_ = x[ParseVar-34]
+	_ = x[ParseVartype-35]
 }
 
-const _ParseKind_name = "ParseNoneParseArgsParseBlockParseCallParseCaseParseCommentParseElseParseFunParseInfixParseJunkParseModifyParseParamParseParamsParsePrefixParseReturnParseStringParseSwitchParseSwitchEmptyParseTokenParseVar"
+const _ParseKind_name = "ParseNoneParseArgsParseAssignParseBlockParseCallParseCaseParseClassParseCommentParseElseParseEnumParseForParseFunParseFunTypeParseGetParseIfParseImportParseIndexParseInfixParseJunkParseLabelParseListParseModifyParseParamParseParamsParsePrefixParseReturnParseStringParseSwitchParseStructParseSwitchEmptyParseTokenParseTryParseTupleParseUseParseVarParseVartype"
 
-var _ParseKind_index = [...]uint8{0, 9, 18, 28, 37, 46, 58, 67, 75, 85, 94, 105, 115, 126, 137, 148, 159, 170, 186, 196, 204}
+var _ParseKind_index = [...]uint16{0, 9, 18, 29, 39, 48, 57, 67, 79, 88, 97, 105, 113, 125, 133, 140, 151, 161, 171, 180, 190, 199, 210, 220, 231, 242, 253, 264, 275, 286, 302, 312, 320, 330, 338, 346, 358}
 
 func (i ParseKind) String() string {
 	idx := int(i) - 0
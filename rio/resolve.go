@@ -1,13 +1,20 @@
 package rio
 
+import "slices"
+
 func (r *resolver) Resolve(m *Module) {
 	if m.Tops == nil {
 		m.Tops = make(map[string]Node)
 	}
+	r.consts = r.consts[:0]
+	r.frames = r.frames[:0]
 	r.funs = r.funs[:0]
+	r.loops = r.loops[:0]
 	r.levels = append(r.levels[:0], 0)
+	r.module = m
 	r.scope = r.scope[:0]
 	r.tops = m.Tops
+	r.typeParams = r.typeParams[:0]
 	r.resolveRoot(m.Root.(*Block))
 }
 
@@ -17,11 +24,17 @@ type Pair[A, B any] struct {
 }
 
 type resolver struct {
+	consts []*Var // evaluated after analysis
 	core   map[string]Node
+	frames []Pair[Node, int] // Funs and records, with their scope starts.
 	funs   []Node
 	levels []int // Indices into scope. TODO Useless? Or needed for closures?
+	loops  []Node
+	module *Module
 	scope  []Pair[string, Node]
 	tops   map[string]Node
+	// Type params kept apart from scope, since they take no stack slots.
+	typeParams []Pair[string, Node]
 }
 
 func (r *resolver) popLevel() int {
@@ -36,6 +49,25 @@ func (r *resolver) pushLevel() {
 	r.levels = append(r.levels, len(r.scope))
 }
 
+// Gives the stack offset for the next scope entry in the current frame.
+func (r *resolver) frameOffset() int {
+	offset := len(r.scope)
+	if len(r.frames) > 0 {
+		offset -= last(&r.frames).Second
+	}
+	return offset
+}
+
+func (r *resolver) popFrame() int {
+	pop(&r.frames)
+	return r.popLevel()
+}
+
+func (r *resolver) pushFrame(node Node) {
+	r.pushLevel()
+	r.frames = append(r.frames, Pair[Node, int]{node, len(r.scope)})
+}
+
 func (r *resolver) resolveRoot(root *Block) {
 	// Clear current tops while retaining capacity.
 	// TODO Presume they don't change?
@@ -49,17 +81,34 @@ Tops:
 		name := ""
 		switch k := kid.(type) {
 		case *Fun:
+			if k.Receiver != nil {
+				// Found through their receiver type instead.
+				continue Tops
+			}
+			name = k.Name
+		case *Import:
+			if k.From != nil {
+				continue Tops
+			}
 			name = k.Name
+		case *Record:
+			name = k.Name
+		case *Unpack:
+			for _, v := range k.Vars {
+				r.addTop(v.(*Var).Name, v)
+			}
+			continue Tops
 		case *Var:
 			name = k.Name
 		default:
 			continue Tops
 		}
-		switch _, found := r.tops[name]; found {
-		case true:
-			// TODO Report error
-		default:
-			r.tops[name] = kid
+		r.addTop(name, kid)
+	}
+	// Bind used names once imports are in tops.
+	for _, kid := range root.Kids {
+		if imp, ok := kid.(*Import); ok {
+			r.resolveImport(imp)
 		}
 	}
 	// Now recurse.
@@ -67,12 +116,52 @@ Tops:
 		switch k := kid.(type) {
 		case *Fun:
 			r.resolveFun(k)
+		case *Record:
+			r.resolveRecord(k)
 		case *Var:
 			r.resolveVar(k)
 		default:
 			r.resolveNode(&root.Kids[i])
 		}
 	}
+	// Attach methods now that records have their fields.
+	for _, kid := range root.Kids {
+		if f, ok := kid.(*Fun); ok && f.Receiver != nil {
+			switch rec := f.Receiver.(*Ref).Target.(type) {
+			case nil:
+			case *Record:
+				r.addMember(rec, f.Name, f)
+			default:
+				r.module.problem(f.Index, "receiver not a record type: "+f.Name)
+			}
+		}
+	}
+}
+
+func (r *resolver) addTop(name string, node Node) {
+	switch _, found := r.tops[name]; found {
+	case true:
+		// TODO Report error
+	default:
+		r.tops[name] = node
+	}
+}
+
+func (r *resolver) resolveAssign(a *Assign) {
+	r.resolveNode(&a.Target)
+	r.resolveNode(&a.Value)
+	switch target := a.Target.(type) {
+	case *Ref:
+		switch v := target.Target.(type) {
+		case nil:
+		case *Var:
+			if v.Flags&NodeFlagChange == 0 {
+				r.module.problem(a.Index, "var not changeable: "+v.Name)
+			}
+		default:
+			r.module.problem(a.Index, "not a var: "+target.Name)
+		}
+	}
 }
 
 func (r *resolver) resolveBlock(b *Block) {
@@ -91,8 +180,8 @@ func (r *resolver) resolveCall(c *Call) {
 }
 
 func (r *resolver) resolveCase(c *Case) {
+	// Pattern vars, as in `case Some(var x)`, are scoped to the case.
 	r.pushLevel()
-	// TODO Vars introduced in pattern matching.
 	for _, pattern := range c.Patterns {
 		r.resolveNode(&pattern)
 	}
@@ -103,20 +192,50 @@ func (r *resolver) resolveCase(c *Case) {
 	r.popLevel()
 }
 
+func (r *resolver) resolveFor(f *For) {
+	r.resolveNode(&f.Subject)
+	r.pushLevel()
+	if f.Item != nil {
+		r.resolveNode(&f.Item)
+	}
+	r.loops = append(r.loops, f)
+	for i := range f.Kids {
+		r.resolveNode(&f.Kids[i])
+	}
+	pop(&r.loops)
+	r.popLevel()
+}
+
 func (r *resolver) resolveFun(f *Fun) {
-	if len(r.levels) > 1 {
+	if len(r.levels) > 1 && f.Name != "" {
+		// Anonymous funs are only values, not in scope.
+		f.Offset = r.frameOffset()
 		r.scope = append(r.scope, Pair[string, Node]{f.Name, f})
 	}
+	// Loops don't reach inside nested funs, so hide outer ones.
+	loops := r.loops
+	r.loops = r.loops[len(r.loops):]
 	r.funs = append(r.funs, f)
-	r.pushLevel()
+	typeParamsLen := len(r.typeParams)
+	if f.Receiver != nil {
+		// Methods also see the type params of their receiver type.
+		r.resolveNode(&f.Receiver)
+		if rec, ok := f.Receiver.(*Ref).Target.(*Record); ok {
+			r.pushTypeParams(rec.TypeParams)
+		}
+	}
+	r.pushTypeParams(f.TypeParams)
+	r.pushFrame(f)
 	for _, p := range f.Params {
 		r.resolveNode(&p)
 	}
 	for i := range f.Kids {
 		r.resolveNode(&f.Kids[i])
 	}
-	f.Size = r.popLevel()
+	f.Size = r.popFrame()
+	r.typeParams = r.typeParams[:typeParamsLen]
 	pop(&r.funs)
+	r.loops = loops
 }
 
 func (r *resolver) resolveGet(g *Get) {
@@ -124,32 +243,181 @@ func (r *resolver) resolveGet(g *Get) {
 	// TODO Resolve member based on the type of subject.
 }
 
+func (r *resolver) resolveImport(imp *Import) {
+	module := imp.Module
+	if imp.From != nil {
+		from := imp.From.(*Ref)
+		r.resolveRef(from)
+		fromImport, ok := from.Target.(*Import)
+		if !ok {
+			r.module.problem(imp.Index, "not an import: "+from.Name)
+			return
+		}
+		module = fromImport.Module
+	}
+	if module == nil {
+		// Failed to load, which is reported elsewhere.
+		return
+	}
+	for i := range imp.Uses {
+		use := &imp.Uses[i]
+		target, problem := pubTop(module, use.Name)
+		if target == nil {
+			r.module.problem(imp.Index, problem)
+			continue
+		}
+		use.Target = target
+		r.addTop(use.Alias, target)
+	}
+}
+
+// Finds a top that other modules can use, else says why not.
+func pubTop(m *Module, name string) (Node, string) {
+	top, ok := m.Tops[name]
+	if !ok {
+		return nil, "not found in module: " + name
+	}
+	var flags NodeFlags
+	switch top := top.(type) {
+	case *Fun:
+		flags = top.Flags
+	case *Record:
+		flags = top.Flags
+	case *Var:
+		flags = top.Flags
+	}
+	if flags&NodeFlagPub == 0 {
+		return nil, "not pub: " + name
+	}
+	return top, ""
+}
+
+func (r *resolver) resolveList(l *List) {
+	for i := range l.Items {
+		r.resolveNode(&l.Items[i])
+	}
+}
+
 // We were passing around *Node instead of Node to replace with *Ref, but now
 // we just change the target node inside existing refs.
 // TODO Change to just Node here?
 func (r *resolver) resolveNode(node *Node) {
 	switch n := (*node).(type) {
+	case *Assign:
+		r.resolveAssign(n)
 	case *Block:
 		r.resolveBlock(n)
 	case *Call:
 		r.resolveCall(n)
 	case *Case:
 		r.resolveCase(n)
+	case *Cast:
+		r.resolveNode(&n.Subject)
+		r.resolveNode(&n.TypeSpec)
+	case *For:
+		r.resolveFor(n)
 	case *Fun:
 		r.resolveFun(n)
+	case *FunSpec:
+		for i := range n.Params {
+			r.resolveNode(&n.Params[i])
+		}
+		r.resolveNode(&n.RetSpec)
 	case *Get:
 		r.resolveGet(n)
+	case *List:
+		r.resolveList(n)
+	case *Logic:
+		for i := range n.Args {
+			r.resolveNode(&n.Args[i])
+		}
+	case *Maybe:
+		r.resolveNode(&n.Item)
+	case *Record:
+		r.resolveRecord(n)
 	case *Ref:
 		r.resolveRef(n)
 	case *Return:
 		r.resolveReturn(n)
 	case *Switch:
 		r.resolveSwitch(n)
+	case *Try:
+		r.resolveTry(n)
+	case *Tuple:
+		for i := range n.Items {
+			r.resolveNode(&n.Items[i])
+		}
+	case *Unpack:
+		r.resolveUnpack(n)
 	case *Var:
 		r.resolveVar(n)
+	case *Vartype:
+		// Only the type specs, since vartypes aren't in scope.
+		for _, kid := range n.Kids {
+			r.resolveNode(&kid.(*Var).TypeSpec)
+		}
+	}
+}
+
+func (r *resolver) resolveRecord(rec *Record) {
+	// Variants are found as union members instead of in scope.
+	if len(r.levels) > 1 && rec.Union == nil {
+		r.scope = append(r.scope, Pair[string, Node]{rec.Name, rec})
+	}
+	if rec.MemberMap == nil {
+		rec.MemberMap = make(map[string]Node)
+	}
+	clear(rec.MemberMap)
+	rec.Members = rec.Members[:0]
+	typeParamsLen := len(r.typeParams)
+	r.pushTypeParams(rec.TypeParams)
+	r.pushFrame(rec)
+	for i, p := range rec.Params {
+		r.resolveNode(&rec.Params[i])
+		if v := p.(*Var); v.Flags&NodeFlagField != 0 {
+			r.addMember(rec, v.Name, v)
+		}
+	}
+	for i, kid := range rec.Kids {
+		if k, ok := kid.(*Record); ok && rec.Kind == TokenUnion {
+			k.Union = rec
+		}
+		r.resolveNode(&rec.Kids[i])
+		switch k := kid.(type) {
+		case *Record:
+			if k.Union == rec {
+				r.addMember(rec, k.Name, k)
+			}
+		case *Tag:
+			k.Type = rec
+			r.addMember(rec, k.Name, k)
+		case *Var:
+			r.addMember(rec, k.Name, k)
+		}
+	}
+	if rec.Kind == TokenEnum || rec.Kind == TokenUnion {
+		r.addMember(rec, "eq", anyEq)
+	}
+	rec.Size = r.popFrame()
+	r.typeParams = r.typeParams[:typeParamsLen]
+}
+
+func (r *resolver) pushTypeParams(params []Node) {
+	for _, param := range params {
+		pair := Pair[string, Node]{param.(*TypeParam).Name, param}
+		r.typeParams = append(r.typeParams, pair)
 	}
 }
 
+func (r *resolver) addMember(rec *Record, name string, member Node) {
+	if _, found := rec.MemberMap[name]; found {
+		r.module.problem(rec.Index, "duplicate member: "+name)
+		return
+	}
+	rec.Members = append(rec.Members, member)
+	rec.MemberMap[name] = member
+}
+
 func (r *resolver) resolveRef(n *Ref) {
 	if n.Target != nil {
 		return
@@ -157,6 +425,17 @@ func (r *resolver) resolveRef(n *Ref) {
 	for i := len(r.scope) - 1; i >= 0; i-- {
 		pair := r.scope[i]
 		if pair.First == n.Name {
+			if !r.capture(i, pair.Second) {
+				// Left unresolved so each round reports it.
+				r.module.problem(n.Index, "can't capture through record: "+n.Name)
+				return
+			}
+			n.Target = pair.Second
+			return
+		}
+	}
+	for i := len(r.typeParams) - 1; i >= 0; i-- {
+		if pair := r.typeParams[i]; pair.First == n.Name {
 			n.Target = pair.Second
 			return
 		}
@@ -172,31 +451,96 @@ func (r *resolver) resolveRef(n *Ref) {
 	}
 }
 
+// Marks a var or nested fun from an enclosing fun as captured, adding it to
+// the captures of each fun in between. Records have no captures, so this
+// says false for any capture into or out of one.
+func (r *resolver) capture(scopeIndex int, target Node) bool {
+	var flags *NodeFlags
+	switch target := target.(type) {
+	case *Fun:
+		flags = &target.Flags
+	case *Var:
+		if target.Flags&NodeFlagConst != 0 {
+			// Consts are just values.
+			return true
+		}
+		flags = &target.Flags
+	default:
+		return true
+	}
+	inner := len(r.frames)
+	for inner > 0 && r.frames[inner-1].Second > scopeIndex {
+		inner--
+	}
+	if inner == 0 || inner == len(r.frames) {
+		// Not from an enclosing frame.
+		return true
+	}
+	for _, frame := range r.frames[inner-1:] {
+		if _, ok := frame.First.(*Fun); !ok {
+			return false
+		}
+	}
+	*flags |= NodeFlagCapture
+	for _, frame := range r.frames[inner:] {
+		f := frame.First.(*Fun)
+		if !slices.Contains(f.Captures, target) {
+			f.Captures = append(f.Captures, target)
+		}
+	}
+	return true
+}
+
 func (r *resolver) resolveReturn(ret *Return) {
-	// TODO Resolve label?
-	switch ret.Kind {
-	case TokenBreak:
-		// switch t := ret.Target.(type) {
-		// case *Value:
-		// 	fmt.Printf("t.Value: %v\n", t.Value)
-		// }
-	case TokenReturn:
-		switch ret.Target {
-		case nil:
-			if len(r.funs) > 0 {
-				ret.Target = *last(&r.funs)
+	if label, ok := ret.Target.(*Ref); ok {
+		// Keep the name so each round resolves it afresh.
+		ret.Label = label.Name
+	}
+	switch {
+	case ret.Label != "":
+		ret.Target = r.resolveLabel(ret.Kind, ret.Label)
+		if ret.Target == nil {
+			r.module.problem(ret.Index, "unknown label: "+ret.Label)
+		}
+	default:
+		switch ret.Kind {
+		case TokenBreak, TokenContinue:
+			ret.Target = nil
+			if len(r.loops) > 0 {
+				ret.Target = *last(&r.loops)
+			} else if ret.Kind == TokenBreak {
+				r.module.problem(ret.Index, "break outside loop")
+			} else {
+				r.module.problem(ret.Index, "continue outside loop")
 			}
-		default:
-			switch ret.Target.(type) {
-			case *Fun:
-			default:
-				// TODO Error?
+		case TokenReturn, TokenYield:
+			// Yields type their fun, though they suspend whatever coroutine runs.
+			if ret.Target == nil && len(r.funs) > 0 {
+				ret.Target = *last(&r.funs)
 			}
 		}
 	}
 	r.resolveNode(&ret.Value)
 }
 
+func (r *resolver) resolveLabel(kind TokenKind, name string) Node {
+	switch kind {
+	case TokenBreak, TokenContinue:
+		for i := len(r.loops) - 1; i >= 0; i-- {
+			if r.loops[i].(*For).Name == name {
+				return r.loops[i]
+			}
+		}
+	case TokenReturn, TokenYield:
+		for i := len(r.funs) - 1; i >= 0; i-- {
+			if r.funs[i].(*Fun).Name == name {
+				return r.funs[i]
+			}
+		}
+	}
+	return nil
+}
+
 func (r *resolver) resolveSwitch(s *Switch) {
 	r.resolveNode(&s.Subject)
 	for _, kid := range s.Kids {
@@ -204,11 +548,39 @@ func (r *resolver) resolveSwitch(s *Switch) {
 	}
 }
 
+func (r *resolver) resolveTry(t *Try) {
+	r.resolveNode(&t.Subject)
+	// The error var is scoped to the handler.
+	r.pushLevel()
+	r.resolveNode(&t.Error)
+	for i := range t.Kids {
+		r.resolveNode(&t.Kids[i])
+	}
+	r.popLevel()
+}
+
+func (r *resolver) resolveUnpack(u *Unpack) {
+	// Resolve the value first to match the runtime stack while it runs.
+	r.resolveNode(&u.Value)
+	for _, v := range u.Vars {
+		r.resolveVar(v.(*Var))
+	}
+}
+
 func (r *resolver) resolveVar(v *Var) {
+	// Resolve the value first to match the runtime stack while it runs.
+	r.resolveNode(&v.TypeSpec)
+	r.resolveNode(&v.Value)
+	if v.Flags&NodeFlagConst != 0 {
+		switch v.Value {
+		case nil:
+			r.module.problem(v.Index, "const needs value: "+v.Name)
+		default:
+			r.consts = append(r.consts, v)
+		}
+	}
 	if len(r.levels) > 1 {
-		v.Offset = len(r.scope)
+		v.Offset = r.frameOffset()
 		r.scope = append(r.scope, Pair[string, Node]{v.Name, v})
 	}
-	r.resolveNode(&v.TypeSpec)
-	r.resolveNode(&v.Value)
 }
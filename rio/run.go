@@ -3,16 +3,16 @@ package rio
 import (
 	"errors"
 	"fmt"
+	"iter"
 	"log"
 	"reflect"
+	"slices"
+	"strconv"
+	"strings"
 )
 
 func (r *runner) Run(m *Module) (err error) {
-	r.module = m
-	r.reflectArgs = r.reflectArgs[:0]
-	r.returnKind = TokenNone
-	r.stack = r.stack[:0]
-	r.levels = append(r.levels[:0], runLevel{})
+	r.start(m)
 	main, ok := m.Tops["main"]
 	if !ok {
 		return errors.New("no main")
@@ -23,29 +23,361 @@ func (r *runner) Run(m *Module) (err error) {
 		return errors.New("main not a function")
 	}
 	// TODO Push sys.
-	defer func() {
-		if rec := recover(); rec != nil {
-			// log.Println(rec)
-			err = fmt.Errorf("%v", rec)
-		}
-	}()
+	for range mainFun.Params {
+		r.stack = append(r.stack, nil)
+	}
+	defer r.stopCoroutines()
+	defer catchRun(&err)
 	r.runFun(mainFun)
 	return
 }
 
-// TODO Separate runner per coroutine?
+// Evaluates a pure expression during analysis, as for consts.
+func (r *runner) Eval(m *Module, node Node) (value any, err error) {
+	r.start(m)
+	defer catchRun(&err)
+	value = r.runNode(node)
+	return
+}
+
+func (r *runner) start(m *Module) {
+	r.coroutines = r.coroutines[:0]
+	r.module = m
+	r.reflectArgs = r.reflectArgs[:0]
+	r.returnKind = TokenNone
+	r.returnTarget = nil
+	r.stack = r.stack[:0]
+	r.levels = append(r.levels[:0], runLevel{})
+}
+
+// Converts panics to errors, meant to be deferred.
+func catchRun(err *error) {
+	if rec := recover(); rec != nil {
+		// log.Println(rec)
+		switch rec := rec.(type) {
+		case *RunError:
+			*err = rec
+		default:
+			*err = fmt.Errorf("%v", rec)
+		}
+	}
+}
+
+// Script-level error from a run, as opposed to a bug in the runner. These
+// can be caught by try handlers.
+type RunError struct {
+	Message string
+	Payload any
+}
+
+func (e *RunError) Error() string {
+	return e.Message
+}
+
+func fail(format string, args ...any) {
+	panic(&RunError{Message: fmt.Sprintf(format, args...)})
+}
+
+// Each coroutine gets its own runner, so its stack survives suspension.
 type runner struct {
-	levels      []runLevel
-	module      *Module
-	reflectArgs []reflect.Value
-	returnKind  TokenKind
-	stack       []any
+	coroutine    *Coroutine   // nil unless running inside one
+	coroutines   []*Coroutine // made during the run, stopped when it's done
+	levels       []runLevel
+	module       *Module
+	reflectArgs  []reflect.Value
+	returnKind   TokenKind
+	returnTarget Node
+	stack        []any
+	top          *runner // nil unless running inside a coroutine
+}
+
+// Fun run on its own runner, suspending at each yield until resumed. Those
+// left unfinished are stopped once the whole run finishes, so their goroutines
+// don't leak.
+type Coroutine struct {
+	done  bool
+	next  func() (any, bool)
+	stop  func()
+	yield func(any) bool
+}
+
+// Panic value for unwinding a coroutine stopped while suspended.
+type coroutineStop struct{}
+
+func (r *runner) newCoroutine(f any) *Coroutine {
+	c := &Coroutine{}
+	// They can escape their maker, so the top runner keeps them all.
+	top := r
+	if r.top != nil {
+		top = r.top
+	}
+	run := &runner{
+		coroutine: c, levels: []runLevel{{}}, module: r.module, top: top,
+	}
+	c.next, c.stop = iter.Pull(func(yield func(any) bool) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				if _, ok := rec.(coroutineStop); !ok {
+					panic(rec)
+				}
+			}
+		}()
+		c.yield = yield
+		run.callValue(f)
+	})
+	// Finished ones need no stopping, so don't keep them around.
+	top.coroutines = slices.DeleteFunc(top.coroutines, func(c *Coroutine) bool {
+		return c.done
+	})
+	top.coroutines = append(top.coroutines, c)
+	return c
+}
+
+func (r *runner) stopCoroutines() {
+	for _, c := range r.coroutines {
+		c.done = true
+		c.stop()
+	}
+	r.coroutines = r.coroutines[:0]
+}
+
+// Runs until the next yield, giving its value, or none once done.
+func (c *Coroutine) resume() any {
+	if c.done {
+		return nil
+	}
+	value, ok := c.next()
+	if !ok {
+		c.done = true
+		return nil
+	}
+	return value
+}
+
+func (c *Coroutine) String() string {
+	return "Coroutine"
+}
+
+// Shared storage for a var captured by closures.
+type Cell struct {
+	Value any
+}
+
+// Nested fun along with cells for what it captures, in the order of its
+// captures.
+type Closure struct {
+	Fun   *Fun
+	Cells []*Cell
+}
+
+// Wraps values of captured vars in cells, so closures share them.
+func holdValue(v *Var, value any) any {
+	if v.Flags&NodeFlagCapture != 0 {
+		return &Cell{Value: value}
+	}
+	return value
+}
+
+// Instance of a class, where fields are indexed by var offset.
+type Object struct {
+	Type   *Record
+	Fields []any
+}
+
+// Copies struct values, including nested structs, and leaves others as is.
+func copyValue(value any) any {
+	o, ok := value.(*Object)
+	if !ok || o.Type.Kind != TokenStruct {
+		return value
+	}
+	fields := make([]any, len(o.Fields))
+	for i, field := range o.Fields {
+		fields[i] = copyValue(field)
+	}
+	return &Object{Type: o.Type, Fields: fields}
+}
+
+func (o *Object) String() string {
+	b := strings.Builder{}
+	if o.Type.Union != nil {
+		b.WriteString(o.Type.Union.Name)
+		b.WriteString(".")
+	}
+	b.WriteString(o.Type.Name)
+	b.WriteString("(")
+	count := 0
+	for _, member := range o.Type.Members {
+		v, ok := member.(*Var)
+		if !ok {
+			continue
+		}
+		if count > 0 {
+			b.WriteString(", ")
+		}
+		count++
+		fmt.Fprintf(&b, "%s = %s", v.Name, formatValue(o.Fields[v.Offset]))
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+// Checks runtime values against static types, as for is and as. Type args
+// aren't kept at runtime, so generic types only check their record.
+func isType(value any, typ Type) bool {
+	if present, maybe := presentType(typ); maybe {
+		return value == nil || isType(value, present)
+	}
+	switch typ := typ.(type) {
+	case BaseType:
+		switch typ {
+		case TypeAny:
+			return true
+		case TypeBool:
+			_, ok := value.(bool)
+			return ok
+		case TypeFloat:
+			_, ok := value.(float64)
+			return ok
+		case TypeInt:
+			_, ok := value.(int32)
+			return ok
+		case TypeString:
+			_, ok := value.(string)
+			return ok
+		case TypeVoid:
+			return value == nil
+		}
+	case *FunType:
+		switch value.(type) {
+		case *Closure, *Fun:
+			return true
+		}
+	case ListType:
+		items, ok := value.(*Items)
+		if !ok {
+			return false
+		}
+		for _, item := range items.Values {
+			if !isType(item, typ.ItemType) {
+				return false
+			}
+		}
+		return true
+	case *AppliedType:
+		return isType(value, typ.Record)
+	case *Record:
+		switch value := value.(type) {
+		case *Coroutine:
+			return typ == coroutineType
+		case *Object:
+			return value.Type == typ || value.Type.Union == typ
+		case *Tag:
+			return value.Type == typ
+		}
+	case *TupleType:
+		pack, ok := value.(*Pack)
+		if !ok || len(pack.Values) != len(typ.ItemTypes) {
+			return false
+		}
+		for i, item := range pack.Values {
+			if !isType(item, typ.ItemTypes[i]) {
+				return false
+			}
+		}
+		return true
+	case *TypeParam:
+		return true
+	}
+	return false
+}
+
+// Runtime tuple, fixed in size and never changed after creation.
+type Pack struct {
+	Values []any
+}
+
+func (p *Pack) String() string {
+	b := strings.Builder{}
+	b.WriteString("(")
+	for i, item := range p.Values {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(formatValue(item))
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+// Runtime list, shared by reference.
+type Items struct {
+	Values []any
+}
+
+// Checks bounds for an index into the list.
+func (l *Items) index(i any) int {
+	index := int(i.(int32))
+	if index < 0 || index >= len(l.Values) {
+		fail("index out of range: %d of %d", index, len(l.Values))
+	}
+	return index
+}
+
+func (l *Items) String() string {
+	b := strings.Builder{}
+	b.WriteString("[")
+	for i, item := range l.Values {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(formatValue(item))
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// Formats runtime values for display, keeping floats distinct from ints.
+func formatValue(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "none"
+	case float64:
+		return formatFloat(value)
+	}
+	return fmt.Sprint(value)
+}
+
+func formatFloat(x float64) string {
+	s := strconv.FormatFloat(x, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
 }
 
 type runLevel struct {
+	closure    *Closure // nil unless running a closure
 	stackStart int
 }
 
+// Finds the cell for a captured var or nested fun, either from the running
+// closure or from the current frame.
+func (r *runner) cell(holder Node) *Cell {
+	if closure := last(&r.levels).closure; closure != nil {
+		if i := slices.Index(closure.Fun.Captures, holder); i >= 0 {
+			return closure.Cells[i]
+		}
+	}
+	offset := 0
+	switch holder := holder.(type) {
+	case *Fun:
+		offset = holder.Offset
+	case *Var:
+		offset = holder.Offset
+	}
+	return r.stack[r.levelStart()+offset].(*Cell)
+}
+
 func (r *runner) levelStart() int {
 	return last(&r.levels).stackStart
 }
@@ -57,10 +389,8 @@ func (r *runner) popLevel() {
 	// fmt.Printf("popLevel r.levels: %+v\n", r.levels)
 }
 
-func (r *runner) pushLevel(stackStart int) {
-	// TODO Track the statically outer function start for each nested fun?
-	// TODO Part of the state of the runtime closure object?
-	level := runLevel{stackStart: stackStart}
+func (r *runner) pushLevel(stackStart int, closure *Closure) {
+	level := runLevel{closure: closure, stackStart: stackStart}
 	r.levels = append(r.levels, level)
 	// fmt.Printf("pushLevel r.levels: %+v %+v\n", r.levels, r.stack)
 }
@@ -68,16 +398,40 @@ func (r *runner) pushLevel(stackStart int) {
 func (r *runner) runNode(node Node) any {
 	// log.Printf("run node: %+v %T\n", node, node)
 	switch n := node.(type) {
+	case *Assign:
+		return r.runAssign(n)
+	case *Block:
+		return r.runBlock(n)
 	case *Call:
 		return r.runCall(n)
+	case *Cast:
+		return r.runCast(n)
+	case *For:
+		return r.runFor(n)
+	case *Fun:
+		return r.runFunDef(n)
 	case *Get:
 		return r.runGet(n)
+	case *List:
+		return r.runList(n)
+	case *Logic:
+		return r.runLogic(n)
+	case *Record:
+		// Nested records take a slot to match their place in scope.
+		r.stack = append(r.stack, n)
+		return nil
 	case *Ref:
 		return r.runRef(n)
 	case *Return:
 		return r.runReturn(n)
 	case *Switch:
 		return r.runSwitch(n)
+	case *Try:
+		return r.runTry(n)
+	case *Tuple:
+		return r.runTuple(n)
+	case *Unpack:
+		return r.runUnpack(n)
 	case *Value:
 		return r.runValue(n)
 	case *Var:
@@ -86,6 +440,37 @@ func (r *runner) runNode(node Node) any {
 	return nil
 }
 
+func (r *runner) runAssign(a *Assign) any {
+	value := copyValue(r.runNode(a.Value))
+	switch target := a.Target.(type) {
+	case *Get:
+		subject := r.runNode(target.Subject)
+		v := target.Member.(*Ref).Target.(*Var)
+		subject.(*Object).Fields[v.Offset] = value
+		return value
+	case *Ref:
+		switch v := target.Target.(type) {
+		case *Var:
+			if v.Flags&NodeFlagCapture != 0 {
+				r.cell(v).Value = value
+				return value
+			}
+			r.stack[r.levelStart()+v.Offset] = value
+			return value
+		}
+	}
+	fail("not assignable")
+	return nil
+}
+
+// Runs a nested block, dropping its vars after.
+func (r *runner) runBlock(b *Block) any {
+	stackLen := len(r.stack)
+	value := r.runBlockKids(b.Kids)
+	r.stack = r.stack[:stackLen]
+	return value
+}
+
 func (r *runner) runBlockKids(kids []Node) any {
 	var value any
 	for _, k := range kids {
@@ -104,34 +489,174 @@ func (r *runner) runCall(c *Call) any {
 	var callee any
 	switch calleeNode := c.Callee.(type) {
 	case *Get:
+		if _, ok := memberTarget(calleeNode).(*Var); ok {
+			// Fun stored in a field, which takes no self.
+			callee = r.runNode(calleeNode)
+			break
+		}
 		var subject any
 		// Split these out to prevent binding allocation.
 		subject = r.runNode(calleeNode.Subject)
 		callee = r.runNode(calleeNode.Member)
 		// log.Printf("subject: %v\n", subject)
 		// log.Printf("callee: %v\n", callee)
-		r.stack = append(r.stack, subject)
+		switch subject.(type) {
+		case *Module, *Record:
+			// Static access needs no subject.
+		default:
+			if !changesSelf(callee) {
+				// Receivers without `&` get their own copy of structs.
+				subject = copyValue(subject)
+			}
+			r.stack = append(r.stack, subject)
+		}
 	default:
 		callee = r.runNode(c.Callee)
 	}
-	f, ok := callee.(*Fun)
-	if !ok {
-		panic("callee not fun")
-	}
-	// TODO How to handle nested funs and captures right?
 	for _, a := range c.Args {
-		arg := r.runNode(a)
+		arg := copyValue(r.runNode(a))
 		// log.Printf("arg: %v\n", arg)
 		r.stack = append(r.stack, arg)
 	}
-	r.pushLevel(stackStart)
+	closure, _ := callee.(*Closure)
+	r.pushLevel(stackStart, closure)
 	// fmt.Printf("call f.Name: %v %v %+v\n", f.Name, stackStart, r.stack)
-	value := r.runFun(f)
+	var value any
+	switch f := callee.(type) {
+	case *Closure:
+		value = r.runFun(f.Fun)
+	case *Fun:
+		value = r.runFun(f)
+	case *Record:
+		value = r.runConstruct(f)
+	default:
+		fail("not a fun: %s", formatValue(callee))
+	}
 	// log.Printf("return value: %v\n", value)
 	r.popLevel()
 	return value
 }
 
+func changesSelf(callee any) bool {
+	f, ok := callee.(*Fun)
+	if !ok || len(f.Params) == 0 {
+		return false
+	}
+	self, ok := f.Params[0].(*Var)
+	return ok && self.Flags&NodeFlagChange != 0
+}
+
+// Calls a fun value from native code.
+func (r *runner) callValue(f any, args ...any) any {
+	stackStart := len(r.stack)
+	r.stack = append(r.stack, args...)
+	closure, _ := f.(*Closure)
+	r.pushLevel(stackStart, closure)
+	var value any
+	switch f := f.(type) {
+	case *Closure:
+		value = r.runFun(f.Fun)
+	case *Fun:
+		value = r.runFun(f)
+	default:
+		fail("not a fun: %s", formatValue(f))
+	}
+	r.popLevel()
+	return value
+}
+
+func (r *runner) runCast(c *Cast) any {
+	value := r.runNode(c.Subject)
+	ok := isType(value, c.Type)
+	if c.Kind == TokenAs {
+		if !ok {
+			fail("failed cast as %s: %s", typeName(c.Type), formatValue(value))
+		}
+		return value
+	}
+	return ok
+}
+
+func (r *runner) runConstruct(rec *Record) any {
+	levelStart := r.levelStart()
+	if argCount := len(r.stack) - levelStart; argCount != len(rec.Params) {
+		fail("wrong arg count: got %d, want %d", argCount, len(rec.Params))
+	}
+	for _, k := range rec.Kids {
+		r.runNode(k)
+	}
+	// Keep the constructor frame as the fields.
+	fields := make([]any, len(r.stack)-levelStart)
+	copy(fields, r.stack[levelStart:])
+	return &Object{Type: rec, Fields: fields}
+}
+
+func (r *runner) runFor(f *For) any {
+	stackLen := len(r.stack)
+	var value any
+	done := false
+	switch f.Item {
+	case nil:
+		for !done && (f.Subject == nil || r.runNode(f.Subject) == true) {
+			value, done = r.runForKids(f, stackLen)
+		}
+	default:
+		subject := r.runNode(f.Subject)
+		item := f.Item.(*Var)
+		// Reserve the item slot.
+		r.stack = append(r.stack, nil)
+		switch s := subject.(type) {
+		case int32:
+			for i := int32(0); !done && i < s; i++ {
+				r.stack[stackLen] = holdValue(item, i)
+				value, done = r.runForKids(f, stackLen+1)
+			}
+		case *Items:
+			for i := 0; !done && i < len(s.Values); i++ {
+				r.stack[stackLen] = holdValue(item, s.Values[i])
+				value, done = r.runForKids(f, stackLen+1)
+			}
+		case *Coroutine:
+			for !done {
+				next := s.resume()
+				if s.done {
+					break
+				}
+				r.stack[stackLen] = holdValue(item, next)
+				value, done = r.runForKids(f, stackLen+1)
+			}
+		default:
+			fail("not iterable: %s", formatValue(s))
+		}
+	}
+	r.stack = r.stack[:stackLen]
+	return value
+}
+
+// Runs one iteration, and says if the loop is done.
+func (r *runner) runForKids(f *For, stackLen int) (any, bool) {
+	value := r.runBlockKids(f.Kids)
+	r.stack = r.stack[:stackLen]
+	switch r.returnKind {
+	case TokenNone:
+		// Loops without break have no value.
+		return nil, false
+	case TokenBreak, TokenContinue:
+		if r.returnTarget != f {
+			// Some outer loop.
+			return value, true
+		}
+		kind := r.returnKind
+		r.returnKind = TokenNone
+		r.returnTarget = nil
+		if kind == TokenContinue {
+			return nil, false
+		}
+		return value, true
+	}
+	return value, true
+}
+
 func (r *runner) runFun(f *Fun) any {
 	// fmt.Printf("runFun f.Name: %v\n", f.Name)
 	levelStart := r.levelStart()
@@ -143,84 +668,238 @@ func (r *runner) runFun(f *Fun) any {
 			switch f2 := v.(type) {
 			case func(int32, int32) bool:
 				if argCount != 2 {
-					panic("bad arg count")
+					fail("wrong arg count: got %d, want 2", argCount)
 				}
 				i, ok := r.stack[len(r.stack)-2].(int32)
 				if !ok {
-					panic("bad arg type")
+					fail("wrong arg type")
 				}
 				j, ok := r.stack[len(r.stack)-1].(int32)
 				if !ok {
-					panic("bad arg type")
+					fail("wrong arg type")
 				}
 				return f2(i, j)
 			case func(int32, int32) int32:
 				if argCount != 2 {
-					panic("bad arg count")
+					fail("wrong arg count: got %d, want 2", argCount)
 				}
 				i, ok := r.stack[len(r.stack)-2].(int32)
 				if !ok {
-					panic("bad arg type")
+					fail("wrong arg type")
 				}
 				j, ok := r.stack[len(r.stack)-1].(int32)
 				if !ok {
-					panic("bad arg type")
+					fail("wrong arg type")
 				}
 				return f2(i, j)
+			case func(float64, float64) bool:
+				if argCount != 2 {
+					fail("wrong arg count: got %d, want 2", argCount)
+				}
+				x, ok := r.stack[len(r.stack)-2].(float64)
+				if !ok {
+					fail("wrong arg type")
+				}
+				y, ok := r.stack[len(r.stack)-1].(float64)
+				if !ok {
+					fail("wrong arg type")
+				}
+				return f2(x, y)
+			case func(float64, float64) float64:
+				if argCount != 2 {
+					fail("wrong arg count: got %d, want 2", argCount)
+				}
+				x, ok := r.stack[len(r.stack)-2].(float64)
+				if !ok {
+					fail("wrong arg type")
+				}
+				y, ok := r.stack[len(r.stack)-1].(float64)
+				if !ok {
+					fail("wrong arg type")
+				}
+				return f2(x, y)
+			case func(any, any) bool:
+				if argCount != 2 {
+					fail("wrong arg count: got %d, want 2", argCount)
+				}
+				return f2(r.stack[len(r.stack)-2], r.stack[len(r.stack)-1])
 			case func(any):
 				if argCount != 1 {
-					panic("bad arg count")
+					fail("wrong arg count: got %d, want 1", argCount)
 				}
 				f2(r.stack[len(r.stack)-1])
 				return nil
+			case func(*runner, []any) any:
+				// Native funs that can call back into the runner.
+				return f2(r, r.stack[levelStart:])
 			}
-			if argCount != reflect.TypeOf(v).NumIn() {
-				panic(fmt.Sprintf("reflect fun: %+v %d\n", v, reflect.TypeOf(v).NumIn()))
+			if argCount != t.NumIn() {
+				fail("wrong arg count: got %d, want %d", argCount, t.NumIn())
 			}
 			for i := levelStart; i < len(r.stack); i++ {
-				r.reflectArgs = append(r.reflectArgs, reflect.ValueOf(r.stack[i]))
+				arg := reflect.ValueOf(r.stack[i])
+				if !arg.IsValid() {
+					// None, which is nil for interface params.
+					arg = reflect.Zero(t.In(i - levelStart))
+				}
+				r.reflectArgs = append(r.reflectArgs, arg)
 			}
 			// log.Printf("r.stack: %v\n", r.stack)
 			// log.Printf("r.reflectArgs: %v\n", r.reflectArgs)
 			// TODO Specialize for certain kinds of funs to reduce allocs?
 			results := reflect.ValueOf(v).Call(r.reflectArgs)
+			r.reflectArgs = r.reflectArgs[:0]
+			if n := len(results); n > 0 && t.Out(n-1) == goErrorType {
+				// Go errors from host funs become script errors.
+				if err, _ := results[n-1].Interface().(error); err != nil {
+					fail("%v", err)
+				}
+				results = results[:n-1]
+			}
 			var result any = nil
-			if len(results) > 0 {
+			switch len(results) {
+			case 0:
+			case 1:
 				result = results[0].Interface()
+			default:
+				// Multiple results become a tuple.
+				pack := &Pack{Values: make([]any, len(results))}
+				for i, value := range results {
+					pack.Values[i] = value.Interface()
+				}
+				result = pack
 			}
 			// log.Printf("result: %v\n", result)
-			r.reflectArgs = r.reflectArgs[:0]
 			return result
 		}
 	}
-	// TODO Check arg count.
+	if argCount != len(f.Params) {
+		fail("wrong arg count: got %d, want %d", argCount, len(f.Params))
+	}
+	for _, p := range f.Params {
+		if p := p.(*Var); p.Flags&NodeFlagCapture != 0 {
+			slot := levelStart + p.Offset
+			r.stack[slot] = holdValue(p, r.stack[slot])
+		}
+	}
 	for _, k := range f.Kids {
 		value := r.runNode(k)
 		// TODO Break returns should have been handled before here.
 		if r.returnKind != TokenNone {
 			// log.Printf("returning value: %v\n", value)
 			r.returnKind = TokenNone
+			r.returnTarget = nil
 			return value
 		}
 	}
 	return nil
 }
 
+// Pushes the slot for a nested fun, holding a closure if it captures anything.
+// Anonymous funs instead are just values.
+func (r *runner) runFunDef(f *Fun) any {
+	if f.Name == "" {
+		return r.funValue(f)
+	}
+	slot := len(r.stack)
+	r.stack = append(r.stack, nil)
+	var cell *Cell
+	if f.Flags&NodeFlagCapture != 0 {
+		// Make the cell first, in case the fun captures itself.
+		cell = &Cell{}
+		r.stack[slot] = cell
+	}
+	value := r.funValue(f)
+	switch cell {
+	case nil:
+		r.stack[slot] = value
+	default:
+		cell.Value = value
+	}
+	return nil
+}
+
+// Gives a closure if the fun captures anything, or else the fun itself.
+func (r *runner) funValue(f *Fun) any {
+	if len(f.Captures) == 0 {
+		return f
+	}
+	closure := &Closure{Fun: f, Cells: make([]*Cell, len(f.Captures))}
+	for i, capture := range f.Captures {
+		closure.Cells[i] = r.cell(capture)
+	}
+	return closure
+}
+
 func (r *runner) runGet(g *Get) any {
 	subject := r.runNode(g.Subject)
+	if ref, ok := g.Member.(*Ref); ok {
+		if v, ok := ref.Target.(*Var); ok && v.Flags&NodeFlagConst == 0 {
+			return subject.(*Object).Fields[v.Offset]
+		}
+	}
 	member := r.runNode(g.Member)
 	// TODO If member is a method, bind subject here?
 	_ = subject
 	return member
 }
 
+func (r *runner) runList(l *List) any {
+	values := make([]any, len(l.Items))
+	for i, item := range l.Items {
+		values[i] = copyValue(r.runNode(item))
+	}
+	return &Items{Values: values}
+}
+
+func (r *runner) runLogic(l *Logic) any {
+	switch l.Kind {
+	case TokenAnd:
+		for _, a := range l.Args {
+			if r.runNode(a) != true {
+				return false
+			}
+		}
+		return true
+	case TokenOr:
+		for _, a := range l.Args {
+			if r.runNode(a) == true {
+				return true
+			}
+		}
+		return false
+	}
+	return r.runNode(l.Args[0]) != true
+}
+
 func (r *runner) runRef(ref *Ref) any {
 	switch d := ref.Target.(type) {
 	case *Fun:
+		switch {
+		case d.Flags&NodeFlagCapture != 0:
+			return r.cell(d).Value
+		case len(d.Captures) > 0:
+			return r.stack[r.levelStart()+d.Offset]
+		}
+		return d
+	case *Import:
+		return d.Module
+	case *Record:
 		return d
+	case *Tag:
+		return d
+	case *Value:
+		return d.Value
 	case *Var:
+		if d.Flags&NodeFlagConst != 0 {
+			// Usually already a value from analysis.
+			return r.runNode(d.Value)
+		}
 		// fmt.Printf("d.Name: %v at %v+%v\n", d.Name, start, d.Offset)
 		// fmt.Printf("ref r.levels: %+v %+v\n", r.levels, r.stack)
+		if d.Flags&NodeFlagCapture != 0 {
+			return r.cell(d).Value
+		}
 		value := r.stack[r.levelStart()+d.Offset]
 		// fmt.Printf("var value: %v\n", value)
 		return value
@@ -230,19 +909,26 @@ func (r *runner) runRef(ref *Ref) any {
 
 func (r *runner) runReturn(ret *Return) any {
 	value := r.runNode(ret.Value)
-	r.returnKind = TokenReturn
+	if ret.Kind == TokenYield {
+		if r.coroutine == nil {
+			fail("yield outside coroutine")
+		}
+		if !r.coroutine.yield(value) {
+			// Stopped rather than resumed.
+			panic(coroutineStop{})
+		}
+		return nil
+	}
+	r.returnKind = ret.Kind
+	r.returnTarget = ret.Target
 	// log.Printf("runReturn value: %+v\n", value)
 	return value
 }
 
 func (r *runner) runSwitch(n *Switch) any {
-	subject := n.Subject
-	switch subject {
-	case nil:
-		subject = true
-	default:
-		log.Printf("support switch subject: %+v\n", subject)
-		return nil
+	var subject any = true
+	if n.Subject != nil {
+		subject = r.runNode(n.Subject)
 	}
 Cases:
 	for _, k := range n.Kids {
@@ -252,6 +938,8 @@ Cases:
 			continue Cases
 		}
 		// fmt.Printf("c: %+v\n", c)
+		// Vars in the case are scoped to it, including pattern vars.
+		stackLen := len(r.stack)
 		matched := false
 		switch {
 		case c.Always:
@@ -259,17 +947,29 @@ Cases:
 		default:
 		Patterns:
 			for _, p := range c.Patterns {
-				value := r.runNode(p)
-				if value == subject {
+				if call, ok := p.(*Call); ok {
+					if variant := patternVariant(call); variant != nil {
+						if r.runMatchVariant(call, variant, subject) {
+							matched = true
+							break Patterns
+						}
+						continue Patterns
+					}
+				}
+				if r.matches(n, subject, r.runNode(p)) {
 					matched = true
 					break Patterns
 				}
 			}
-			// TODO Require guard also, if not nil.
+			if matched && c.Gate != nil && r.runNode(c.Gate) != true {
+				matched = false
+				r.stack = r.stack[:stackLen]
+			}
 		}
 		if matched {
 			// println("matches")
 			var value = r.runBlockKids(c.Kids)
+			r.stack = r.stack[:stackLen]
 			// log.Printf("switch value: %v\n", value)
 			return value
 		}
@@ -278,15 +978,145 @@ Cases:
 	return nil
 }
 
+// Compares by the subject type's eq if any, where none only matches none.
+func (r *runner) matches(s *Switch, subject any, value any) bool {
+	if s.Eq == nil || subject == nil || value == nil {
+		return subject == value
+	}
+	return r.callValue(s.Eq, subject, value) == true
+}
+
+// Checks the variant tag of the subject, pushing any pattern vars on match.
+func (r *runner) runMatchVariant(p *Call, variant *Record, subject any) bool {
+	object, ok := subject.(*Object)
+	if !ok || object.Type != variant || len(p.Args) > len(variant.Params) {
+		return false
+	}
+	stackLen := len(r.stack)
+	for i, a := range p.Args {
+		field := object.Fields[variant.Params[i].(*Var).Offset]
+		switch a := a.(type) {
+		case *Var:
+			r.stack = append(r.stack, holdValue(a, field))
+		default:
+			if r.runNode(a) != field {
+				r.stack = r.stack[:stackLen]
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (r *runner) runTry(t *Try) any {
+	if !t.Handled {
+		// Failures already pass on by themselves.
+		return r.runNode(t.Subject)
+	}
+	stackLen := len(r.stack)
+	levelsLen := len(r.levels)
+	value, err := r.runCatching(t.Subject)
+	if err == nil {
+		return value
+	}
+	// Unwind whatever the failure interrupted.
+	r.levels = r.levels[:levelsLen]
+	r.reflectArgs = r.reflectArgs[:0]
+	r.returnKind = TokenNone
+	r.returnTarget = nil
+	r.stack = r.stack[:stackLen]
+	if t.Error != nil {
+		fields := []any{err.Message, err.Payload}
+		errorValue := &Object{Type: errorType, Fields: fields}
+		r.stack = append(r.stack, holdValue(t.Error.(*Var), errorValue))
+	}
+	value = r.runBlockKids(t.Kids)
+	r.stack = r.stack[:stackLen]
+	return value
+}
+
+var goErrorType = reflect.TypeFor[error]()
+
+// Runs the node, recovering any script error, while runner bugs still panic.
+func (r *runner) runCatching(node Node) (value any, err *RunError) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			runErr, ok := rec.(*RunError)
+			if !ok {
+				panic(rec)
+			}
+			err = runErr
+		}
+	}()
+	return r.runNode(node), nil
+}
+
+func (r *runner) runTuple(t *Tuple) any {
+	values := make([]any, len(t.Items))
+	for i, item := range t.Items {
+		values[i] = copyValue(r.runNode(item))
+	}
+	return &Pack{Values: values}
+}
+
+func (r *runner) runUnpack(u *Unpack) any {
+	pack, ok := r.runNode(u.Value).(*Pack)
+	if !ok || len(pack.Values) != len(u.Vars) {
+		fail("can't unpack into %d vars", len(u.Vars))
+	}
+	for i, v := range u.Vars {
+		value := copyValue(pack.Values[i])
+		r.stack = append(r.stack, holdValue(v.(*Var), value))
+	}
+	// The unpack itself has value nil, like var statements.
+	return nil
+}
+
 func (r *runner) runValue(value *Value) any {
 	return value.Value
 }
 
 func (r *runner) runVar(v *Var) any {
-	value := r.runNode(v.Value)
+	var value any
+	switch v.Value {
+	case nil:
+		value = zeroValue(v.Type)
+	default:
+		value = r.runNode(v.Value)
+		if v.Flags&NodeFlagTemp == 0 {
+			value = copyValue(value)
+		}
+	}
 	// fmt.Printf("v: %v %+v\n", v.Name, value)
 	// log.Printf("runVar value: %v\n", value)
-	r.stack = append(r.stack, value)
+	r.stack = append(r.stack, holdValue(v, value))
 	// The var statement itself has value nil.
 	return nil
 }
+
+func zeroValue(t Type) any {
+	switch t {
+	case TypeBool:
+		return false
+	case TypeFloat:
+		return float64(0)
+	case TypeInt:
+		return int32(0)
+	case TypeString:
+		return ""
+	}
+	if _, ok := t.(ListType); ok {
+		return &Items{}
+	}
+	if rec, ok := t.(*Record); ok && rec.Kind == TokenStruct {
+		// Zero fields rather than running any defaults.
+		fields := make([]any, rec.Size)
+		for _, member := range rec.Members {
+			if v, ok := member.(*Var); ok {
+				fields[v.Offset] = zeroValue(v.Type)
+			}
+		}
+		return &Object{Type: rec, Fields: fields}
+	}
+	return nil
+}
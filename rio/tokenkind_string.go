@@ -10,60 +10,85 @@ func _() {
 	var x [1]struct{}
 	_ = x[TokenNone-0]
 	_ = x[TokenAdd-1]
-	_ = x[TokenAs-2]
-	_ = x[TokenBreak-3]
-	_ = x[TokenCase-4]
-	_ = x[TokenChange-5]
-	_ = x[TokenClass-6]
-	_ = x[TokenComma-7]
-	_ = x[TokenCommentOpen-8]
-	_ = x[TokenCommentText-9]
-	_ = x[TokenConst-10]
-	_ = x[TokenContinue-11]
-	_ = x[TokenElse-12]
-	_ = x[TokenEnd-13]
-	_ = x[TokenEq-14]
-	_ = x[TokenEqEq-15]
-	_ = x[TokenEnum-16]
-	_ = x[TokenFor-17]
-	_ = x[TokenFrom-18]
-	_ = x[TokenFun-19]
-	_ = x[TokenGe-20]
-	_ = x[TokenGt-21]
-	_ = x[TokenHSpace-22]
-	_ = x[TokenId-23]
-	_ = x[TokenIf-24]
-	_ = x[TokenInt-25]
-	_ = x[TokenIs-26]
-	_ = x[TokenImport-27]
-	_ = x[TokenLe-28]
-	_ = x[TokenLt-29]
-	_ = x[TokenJunk-30]
-	_ = x[TokenNot-31]
-	_ = x[TokenNEq-32]
-	_ = x[TokenPlug-33]
-	_ = x[TokenPub-34]
-	_ = x[TokenReturn-35]
-	_ = x[TokenRoundClose-36]
-	_ = x[TokenRoundOpen-37]
-	_ = x[TokenStringEscape-38]
-	_ = x[TokenStringText-39]
-	_ = x[TokenStringClose-40]
-	_ = x[TokenStringOpen-41]
-	_ = x[TokenStruct-42]
-	_ = x[TokenSub-43]
-	_ = x[TokenSwitch-44]
-	_ = x[TokenThen-45]
-	_ = x[TokenVSpace-46]
-	_ = x[TokenUnion-47]
-	_ = x[TokenUse-48]
-	_ = x[TokenVar-49]
-	_ = x[TokenVartype-50]
+	_ = x[TokenAddEq-2]
+	_ = x[TokenAmp-3]
+	_ = x[TokenAnd-4]
+	_ = x[TokenAs-5]
+	_ = x[TokenBreak-6]
+	_ = x[TokenCase-7]
+	_ = x[TokenCatch-8]
+	_ = x[TokenChange-9]
+	_ = x[TokenClass-10]
+	_ = x[TokenColon-11]
+	_ = x[TokenComma-12]
+	_ = x[TokenCommentOpen-13]
+	_ = x[TokenCommentText-14]
+	_ = x[TokenConst-15]
+	_ = x[TokenContinue-16]
+	_ = x[TokenDot-17]
+	_ = x[TokenElse-18]
+	_ = x[TokenEnd-19]
+	_ = x[TokenEq-20]
+	_ = x[TokenEqEq-21]
+	_ = x[TokenEnum-22]
+	_ = x[TokenFalse-23]
+	_ = x[TokenFloat-24]
+	_ = x[TokenFor-25]
+	_ = x[TokenFrom-26]
+	_ = x[TokenFun-27]
+	_ = x[TokenGe-28]
+	_ = x[TokenGt-29]
+	_ = x[TokenHSpace-30]
+	_ = x[TokenId-31]
+	_ = x[TokenIf-32]
+	_ = x[TokenIn-33]
+	_ = x[TokenInt-34]
+	_ = x[TokenIs-35]
+	_ = x[TokenImport-36]
+	_ = x[TokenLe-37]
+	_ = x[TokenLt-38]
+	_ = x[TokenJunk-39]
+	_ = x[TokenNot-40]
+	_ = x[TokenNEq-41]
+	_ = x[TokenOr-42]
+	_ = x[TokenPercent-43]
+	_ = x[TokenPercentEq-44]
+	_ = x[TokenPlug-45]
+	_ = x[TokenPub-46]
+	_ = x[TokenQuestion-47]
+	_ = x[TokenReturn-48]
+	_ = x[TokenRoundClose-49]
+	_ = x[TokenRoundOpen-50]
+	_ = x[TokenSlash-51]
+	_ = x[TokenSlashEq-52]
+	_ = x[TokenSquareClose-53]
+	_ = x[TokenSquareOpen-54]
+	_ = x[TokenStar-55]
+	_ = x[TokenStarEq-56]
+	_ = x[TokenStringEscape-57]
+	_ = x[TokenStringExprClose-58]
+	_ = x[TokenStringExprOpen-59]
+	_ = x[TokenStringText-60]
+	_ = x[TokenStringClose-61]
+	_ = x[TokenStringOpen-62]
+	_ = x[TokenStruct-63]
+	_ = x[TokenSub-64]
+	_ = x[TokenSubEq-65]
+	_ = x[TokenSwitch-66]
+	_ = x[TokenThen-67]
+	_ = x[TokenTrue-68]
+	_ = x[TokenTry-69]
+	_ = x[TokenVSpace-70]
+	_ = x[TokenUnion-71]
+	_ = x[TokenUse-72]
+	_ = x[TokenVar-73]
+	_ = x[TokenVartype-74]
+	_ = x[TokenYield-75]
 }
 
-const _TokenKind_name = "TokenNoneTokenAddTokenAsTokenBreakTokenCaseTokenChangeTokenClassTokenCommaTokenCommentOpenTokenCommentTextTokenConstTokenContinueTokenElseTokenEndTokenEqTokenEqEqTokenEnumTokenForTokenFromTokenFunTokenGeTokenGtTokenHSpaceTokenIdTokenIfTokenIntTokenIsTokenImportTokenLeTokenLtTokenJunkTokenNotTokenNEqTokenPlugTokenPubTokenReturnTokenRoundCloseTokenRoundOpenTokenStringEscapeTokenStringTextTokenStringCloseTokenStringOpenTokenStructTokenSubTokenSwitchTokenThenTokenVSpaceTokenUnionTokenUseTokenVarTokenVartype"
+const _TokenKind_name = "TokenNoneTokenAddTokenAddEqTokenAmpTokenAndTokenAsTokenBreakTokenCaseTokenCatchTokenChangeTokenClassTokenColonTokenCommaTokenCommentOpenTokenCommentTextTokenConstTokenContinueTokenDotTokenElseTokenEndTokenEqTokenEqEqTokenEnumTokenFalseTokenFloatTokenForTokenFromTokenFunTokenGeTokenGtTokenHSpaceTokenIdTokenIfTokenInTokenIntTokenIsTokenImportTokenLeTokenLtTokenJunkTokenNotTokenNEqTokenOrTokenPercentTokenPercentEqTokenPlugTokenPubTokenQuestionTokenReturnTokenRoundCloseTokenRoundOpenTokenSlashTokenSlashEqTokenSquareCloseTokenSquareOpenTokenStarTokenStarEqTokenStringEscapeTokenStringExprCloseTokenStringExprOpenTokenStringTextTokenStringCloseTokenStringOpenTokenStructTokenSubTokenSubEqTokenSwitchTokenThenTokenTrueTokenTryTokenVSpaceTokenUnionTokenUseTokenVarTokenVartypeTokenYield"
 
-var _TokenKind_index = [...]uint16{0, 9, 17, 24, 34, 43, 54, 64, 74, 90, 106, 116, 129, 138, 146, 153, 162, 171, 179, 188, 196, 203, 210, 221, 228, 235, 243, 250, 261, 268, 275, 284, 292, 300, 309, 317, 328, 343, 357, 374, 389, 405, 420, 431, 439, 450, 459, 470, 480, 488, 496, 508}
+var _TokenKind_index = [...]uint16{0, 9, 17, 27, 35, 43, 50, 60, 69, 79, 90, 100, 110, 120, 136, 152, 162, 175, 183, 192, 200, 207, 216, 225, 235, 245, 253, 262, 270, 277, 284, 295, 302, 309, 316, 324, 331, 342, 349, 356, 365, 373, 381, 388, 400, 414, 423, 431, 444, 455, 470, 484, 494, 506, 522, 537, 546, 557, 574, 594, 613, 628, 644, 659, 670, 678, 688, 699, 708, 717, 725, 736, 746, 754, 762, 774, 784}
 
 func (i TokenKind) String() string {
 	idx := int(i) - 0
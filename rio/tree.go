@@ -3,13 +3,32 @@ package rio
 import (
 	"fmt"
 	"io"
+	"slices"
+	"strings"
 )
 
 type Module struct {
-	Core    map[string]Node
-	Root    Node // always the last node?
-	Sources []Source
-	Tops    map[string]Node
+	Core     map[string]Node
+	Path     string // empty unless loaded from a file
+	Problems []Problem
+	Root     Node // always the last node?
+	Sources  []Source
+	Tops     map[string]Node
+}
+
+// Something wrong found during analysis, keyed by node index until we track
+// source ranges.
+type Problem struct {
+	Index   int
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("@%d: %s", p.Index, p.Message)
+}
+
+func (m *Module) problem(index int, message string) {
+	m.Problems = append(m.Problems, Problem{Index: index, Message: message})
 }
 
 type Node interface {
@@ -22,12 +41,24 @@ type NodeFlags uint32
 
 const (
 	NodeFlagCapture NodeFlags = 1 << iota
+	NodeFlagChange
+	NodeFlagConst
+	NodeFlagField
 	NodeFlagGlobal
+	NodeFlagOptional
 	NodeFlagPlug
 	NodeFlagPub
+	// Holds the same value rather than a copy.
+	NodeFlagTemp
 	NodeFlagNone NodeFlags = 0
 )
 
+type Assign struct {
+	NodeInfo
+	Target Node
+	Value  Node
+}
+
 type Block struct {
 	NodeInfo
 	Kids []Node
@@ -43,6 +74,15 @@ type Call struct {
 	Args   []Node
 }
 
+// Type test with is, or checked conversion with as.
+type Cast struct {
+	NodeInfo
+	Kind     TokenKind // TokenAs or TokenIs
+	Subject  Node
+	TypeSpec Node
+	Type     Type
+}
+
 type Case struct {
 	NodeInfo
 	Always   bool
@@ -56,14 +96,37 @@ type Def struct {
 	Flags NodeFlags
 }
 
+// Loops while Subject is true, or over Subject as an iterable if there's an
+// Item var. Def names the label, and Type is the type of break values.
+type For struct {
+	NodeInfo
+	Def
+	Type    Type
+	Item    Node // *Var if present
+	Subject Node
+	Kids    []Node
+}
+
 type Fun struct {
 	NodeInfo
 	Def
 	Scope
-	Type    FunType
-	Params  []Node // always *Var
+	Type       FunType
+	Receiver   Node   // type ref for methods declared outside their type
+	TypeParams []Node // always *TypeParam
+	Params     []Node // always *Var, with any receiver first as self
+	RetSpec    Node
+	Kids       []Node
+	Captures   []Node // *Var or *Fun from enclosing funs, shared as cells
+	Offset     int    // stack slot for nested funs
+}
+
+// Fun type spec, as in `fun(Int, T) R`, with Void return if none given.
+type FunSpec struct {
+	NodeInfo
+	Meta    TypeType
+	Params  []Node
 	RetSpec Node
-	Kids    []Node
 }
 
 type Get struct {
@@ -72,34 +135,132 @@ type Get struct {
 	Member  Node
 }
 
+// Loads another module by path, bound by its qualified name, or else names an
+// earlier import, as in `from shapes use area`. Used names are bound directly.
+type Import struct {
+	NodeInfo
+	Def         // qualified name, empty for from
+	From   Node // *Ref to an earlier import, only for from
+	Module *Module
+	Path   string
+	Uses   []Use
+}
+
+// Name bound from an imported module, as in `use area as shapeArea`.
+type Use struct {
+	Name   string // in the imported module
+	Alias  string // local name, the same unless given with as
+	Target Node
+}
+
+// Optional type, as in `?Int`, where values are either the item type or none.
+type Maybe struct {
+	NodeInfo
+	Meta TypeType
+	Item Node
+}
+
+// Class declarations are records whose fields are the vars of the constructor
+// frame, including params marked as var. Union variants with payloads are also
+// class records, but with all params as fields, as are structs, which are
+// copied by value.
 type Record struct {
 	NodeInfo
 	Def
 	Scope
-	Members   []Node
-	MemberMap map[string]Node
+	Kind       TokenKind // TokenClass, TokenEnum, TokenStruct, or TokenUnion
+	Type       FunType   // Constructor
+	Meta       TypeType
+	Union      *Record // Set for variants
+	TypeParams []Node  // always *TypeParam, also in scope for variants
+	Params     []Node  // always *Var
+	Kids       []Node
+	Members    []Node
+	MemberMap  map[string]Node
 }
 
 type Switch struct {
 	NodeInfo
 	Subject Node
+	Eq      Node // *Fun for matching the subject, or nil for identity
 	Kids    []Node
 }
 
+// List literal, or a list type in type position, as from `*Int`.
+type List struct {
+	NodeInfo
+	Type  Type
+	Meta  TypeType
+	Items []Node
+}
+
+// Short-circuit and or or, or else not with a single arg.
+type Logic struct {
+	NodeInfo
+	Kind TokenKind // TokenAnd, TokenNot, or TokenOr
+	Args []Node
+}
+
 type Ref struct {
 	NodeInfo
 	Name   string
 	Target Node
 }
 
+// Named member of an enum or union, where the node itself serves as the runtime
+// value.
+type Tag struct {
+	NodeInfo
+	Def
+	Type *Record
+}
+
+func (t *Tag) String() string {
+	return t.Type.Name + "." + t.Name
+}
+
+// Runs Subject, where failure passes on to the caller unless Handled, in
+// which case Kids run instead with any Error var holding the error.
+type Try struct {
+	NodeInfo
+	Handled bool
+	Subject Node
+	Error   Node // *Var if present
+	Kids    []Node
+}
+
+// Tuple literal, or a tuple type in type position, as in `(Int, String)`.
+type Tuple struct {
+	NodeInfo
+	Type  Type
+	Meta  TypeType
+	Items []Node
+}
+
+// Type param of a generic fun or record, which also serves as its own type.
+// Type args are erased at runtime.
+type TypeParam struct {
+	NodeInfo
+	Def
+	Meta TypeType
+}
+
 // TODO Rename to Break?
 type Return struct {
 	NodeInfo
-	Kind   TokenKind
-	Target Node // From string value to target node, including function.
+	Kind   TokenKind // yields also target funs but continue after resume
+	Label  string    // Explicit target name, if any, kept across resolves.
+	Target Node      // From string value to target node, including function.
 	Value  Node
 }
 
+// Destructures a tuple value into new vars, as in `var (a, b) = f()`.
+type Unpack struct {
+	NodeInfo
+	Vars  []Node // always *Var, without type spec or value
+	Value Node
+}
+
 type Scope struct {
 	// TODO for []any, which should only store pointers to slices
 	Size int
@@ -119,6 +280,12 @@ type Var struct {
 	Offset   int
 }
 
+// Default types by name for untyped vars throughout the enclosing scope.
+type Vartype struct {
+	NodeInfo
+	Kids []Node // always *Var, with only a type spec
+}
+
 // Side info for each node that's not expected to be used often.
 type NodeInfo struct {
 	Index  int
@@ -135,17 +302,32 @@ type NodeKind int
 const (
 	NodeNone NodeKind = iota
 	NodeArgs
+	NodeAssign
 	NodeBlock
 	NodeCall
 	NodeCase
+	NodeCast
+	NodeFor
 	NodeFun
+	NodeFunSpec
 	NodeGet
+	NodeImport
+	NodeList
+	NodeLogic
+	NodeMaybe
+	NodeRecord
 	NodeRef
 	NodeReturn
 	NodeSwitch
+	NodeTag
+	NodeTry
+	NodeTuple
 	NodeType
+	NodeTypeParam
+	NodeUnpack
 	NodeValue
 	NodeVar
+	NodeVartype
 )
 
 //go:generate stringer -type=NodeKind
@@ -173,6 +355,10 @@ func (p *treePrinting) printAt(indent int, node Node) {
 	switch n := node.(type) {
 	case nil:
 		fmt.Fprint(p.w, "nil")
+	case *Assign:
+		p.printAt(indent, n.Target)
+		fmt.Fprint(p.w, " = ")
+		p.printAt(indent, n.Value)
 	case *Block:
 		nextIndent := indent
 		atRoot := node == p.Tree.Root
@@ -202,6 +388,15 @@ func (p *treePrinting) printAt(indent int, node Node) {
 			p.printAt(indent, a)
 		}
 		fmt.Fprint(p.w, ")")
+	case *Cast:
+		p.printAt(indent, n.Subject)
+		switch n.Kind {
+		case TokenAs:
+			fmt.Fprint(p.w, " as ")
+		case TokenIs:
+			fmt.Fprint(p.w, " is ")
+		}
+		p.printAt(indent, n.TypeSpec)
 	case *Case:
 		switch {
 		case n.Always:
@@ -218,13 +413,36 @@ func (p *treePrinting) printAt(indent int, node Node) {
 			}
 			p.printAt(indent, m)
 		}
+		if n.Gate != nil {
+			fmt.Fprint(p.w, " if ")
+			p.printAt(indent, n.Gate)
+		}
 		p.printKids(indent, n.Kids, true)
+	case *For:
+		if n.Name != "" {
+			fmt.Fprintf(p.w, "%s: ", n.Name)
+		}
+		fmt.Fprint(p.w, "for")
+		fmt.Fprintf(p.w, "@%d", n.Index)
+		if n.Item != nil {
+			fmt.Fprint(p.w, " ")
+			p.printVar(n.Item.(*Var), indent)
+			fmt.Fprint(p.w, " in")
+		}
+		if n.Subject != nil {
+			fmt.Fprint(p.w, " ")
+			p.printAt(indent, n.Subject)
+		}
+		p.printKids(indent, n.Kids, false)
+		PrintIndent(p.w, indent)
+		fmt.Fprint(p.w, "end")
 	case *Fun:
 		if n.Flags&NodeFlagPub > 0 {
 			fmt.Fprint(p.w, "pub ")
 		}
 		fmt.Fprint(p.w, "fun")
 		p.printFunLabel(n)
+		p.printTypeParams(n.TypeParams)
 		// TODO If wide, print params on separate lines?
 		fmt.Fprint(p.w, "(")
 		for i, vnode := range n.Params {
@@ -235,18 +453,166 @@ func (p *treePrinting) printAt(indent int, node Node) {
 		}
 		fmt.Fprint(p.w, ")")
 		p.printType(n.Type.RetType)
+		for i, capture := range n.Captures {
+			switch i {
+			case 0:
+				fmt.Fprint(p.w, " captures ")
+			default:
+				fmt.Fprint(p.w, ", ")
+			}
+			switch c := capture.(type) {
+			case *Fun:
+				fmt.Fprintf(p.w, "%s@%d", c.Name, c.Index)
+			case *Var:
+				fmt.Fprintf(p.w, "%s@%d", c.Name, c.Index)
+			}
+		}
 		p.printKids(indent, n.Kids, false)
 		PrintIndent(p.w, indent)
 		fmt.Fprint(p.w, "end")
+	case *FunSpec:
+		fmt.Fprint(p.w, "fun(")
+		for i, param := range n.Params {
+			if i > 0 {
+				fmt.Fprint(p.w, ", ")
+			}
+			p.printAt(indent, param)
+		}
+		fmt.Fprint(p.w, ")")
+		if n.RetSpec != nil {
+			fmt.Fprint(p.w, " ")
+			p.printAt(indent, n.RetSpec)
+		}
 	case *Get:
 		p.printAt(indent, n.Subject)
 		fmt.Fprint(p.w, ".")
 		p.printAt(indent, n.Member)
+	case *Import:
+		switch n.From {
+		case nil:
+			fmt.Fprintf(p.w, "import@%d ", n.Index)
+			PrintEscapedString(p.w, n.Path)
+			fmt.Fprintf(p.w, " as %s", n.Name)
+		default:
+			fmt.Fprintf(p.w, "from@%d ", n.Index)
+			p.printAt(indent, n.From)
+		}
+		for i, use := range n.Uses {
+			switch i {
+			case 0:
+				fmt.Fprint(p.w, " use ")
+			default:
+				fmt.Fprint(p.w, ", ")
+			}
+			fmt.Fprint(p.w, use.Name)
+			if use.Alias != use.Name {
+				fmt.Fprintf(p.w, " as %s", use.Alias)
+			}
+		}
+	case *List:
+		fmt.Fprint(p.w, "[")
+		for i, item := range n.Items {
+			if i > 0 {
+				fmt.Fprint(p.w, ", ")
+			}
+			p.printAt(indent, item)
+		}
+		fmt.Fprint(p.w, "]")
+	case *Logic:
+		switch n.Kind {
+		case TokenNot:
+			fmt.Fprint(p.w, "not ")
+			p.printAt(indent, n.Args[0])
+		default:
+			fmt.Fprint(p.w, "(")
+			for i, a := range n.Args {
+				if i > 0 {
+					switch n.Kind {
+					case TokenAnd:
+						fmt.Fprint(p.w, " and ")
+					case TokenOr:
+						fmt.Fprint(p.w, " or ")
+					}
+				}
+				p.printAt(indent, a)
+			}
+			fmt.Fprint(p.w, ")")
+		}
+	case *Maybe:
+		fmt.Fprint(p.w, "?")
+		p.printAt(indent, n.Item)
+	case *Record:
+		if n.Union != nil {
+			// Variant fields are implied.
+			fmt.Fprintf(p.w, "%s@%d(", n.Name, n.Index)
+			for i, vnode := range n.Params {
+				if i > 0 {
+					fmt.Fprint(p.w, ", ")
+				}
+				p.printVar(vnode.(*Var), indent)
+			}
+			fmt.Fprint(p.w, ")")
+			return
+		}
+		if n.Flags&NodeFlagPub > 0 {
+			fmt.Fprint(p.w, "pub ")
+		}
+		switch n.Kind {
+		case TokenEnum:
+			fmt.Fprint(p.w, "enum")
+		case TokenStruct:
+			fmt.Fprint(p.w, "struct")
+		case TokenUnion:
+			fmt.Fprint(p.w, "union")
+		default:
+			fmt.Fprint(p.w, "class")
+		}
+		if n.Name != "" {
+			fmt.Fprintf(p.w, " %s", n.Name)
+		}
+		fmt.Fprintf(p.w, "@%d", n.Index)
+		p.printTypeParams(n.TypeParams)
+		if n.Kind == TokenEnum || n.Kind == TokenUnion {
+			p.printKids(indent, n.Kids, false)
+			PrintIndent(p.w, indent)
+			fmt.Fprint(p.w, "end")
+			return
+		}
+		fmt.Fprint(p.w, "(")
+		for i, vnode := range n.Params {
+			if i > 0 {
+				fmt.Fprint(p.w, ", ")
+			}
+			v := vnode.(*Var)
+			if v.Flags&NodeFlagField > 0 {
+				if v.Flags&NodeFlagChange > 0 {
+					fmt.Fprint(p.w, "change ")
+				}
+				fmt.Fprint(p.w, "var ")
+			}
+			p.printVar(v, indent)
+		}
+		fmt.Fprint(p.w, ")")
+		p.printKids(indent, n.Kids, false)
+		PrintIndent(p.w, indent)
+		fmt.Fprint(p.w, "end")
 	case *Ref:
 		switch r := n.Target.(type) {
 		case *Fun:
 			fmt.Fprint(p.w, r.Name)
 			fmt.Fprintf(p.w, "@%d", r.Index)
+		case *Import:
+			fmt.Fprint(p.w, r.Name)
+			fmt.Fprintf(p.w, "@%d", r.Index)
+		case *Record:
+			fmt.Fprint(p.w, r.Name)
+			fmt.Fprintf(p.w, "@%d", r.Index)
+		case *Tag:
+			fmt.Fprint(p.w, r.Name)
+			fmt.Fprintf(p.w, "@%d", r.Index)
+		case *TypeParam:
+			fmt.Fprint(p.w, r.Name)
+			fmt.Fprintf(p.w, "@%d", r.Index)
 		case *Var:
 			fmt.Fprint(p.w, r.Name)
 			fmt.Fprintf(p.w, "@%d", r.Index)
@@ -261,9 +627,16 @@ func (p *treePrinting) printAt(indent int, node Node) {
 			fmt.Fprint(p.w, "continue")
 		case TokenReturn:
 			fmt.Fprint(p.w, "return")
+		case TokenYield:
+			fmt.Fprint(p.w, "yield")
 		}
 		if n.Target != nil {
 			switch t := n.Target.(type) {
+			case *For:
+				if t.Name != "" {
+					fmt.Fprintf(p.w, " %s", t.Name)
+				}
+				fmt.Fprintf(p.w, "@%d:", t.Index)
 			case *Fun:
 				p.printFunLabel(t)
 				fmt.Fprint(p.w, ":")
@@ -271,6 +644,9 @@ func (p *treePrinting) printAt(indent int, node Node) {
 				fmt.Fprintf(p.w, "%v %T", n.Target, n.Target)
 				fmt.Fprint(p.w, " =")
 			}
+		} else if n.Label != "" {
+			// Unresolved, as already reported.
+			fmt.Fprintf(p.w, " %s:", n.Label)
 		}
 		if n.Value != nil {
 			fmt.Fprint(p.w, " ")
@@ -279,31 +655,172 @@ func (p *treePrinting) printAt(indent int, node Node) {
 	case *Switch:
 		fmt.Fprint(p.w, "switch")
 		if n.Subject != nil {
+			fmt.Fprint(p.w, " ")
 			p.printAt(indent, n.Subject)
 		}
 		p.printKids(indent-1, n.Kids, false)
 		PrintIndent(p.w, indent)
 		fmt.Fprint(p.w, "end")
+	case *Tag:
+		fmt.Fprint(p.w, n.Name)
+		fmt.Fprintf(p.w, "@%d", n.Index)
+	case *Try:
+		fmt.Fprintf(p.w, "try@%d ", n.Index)
+		p.printAt(indent, n.Subject)
+		if n.Handled {
+			fmt.Fprint(p.w, " catch")
+			if n.Error != nil {
+				fmt.Fprint(p.w, " ")
+				p.printVar(n.Error.(*Var), indent)
+			}
+			p.printKids(indent, n.Kids, false)
+			PrintIndent(p.w, indent)
+			fmt.Fprint(p.w, "end")
+		}
+	case *Tuple:
+		fmt.Fprint(p.w, "(")
+		for i, item := range n.Items {
+			if i > 0 {
+				fmt.Fprint(p.w, ", ")
+			}
+			p.printAt(indent, item)
+		}
+		fmt.Fprint(p.w, ")")
+	case *TypeParam:
+		fmt.Fprint(p.w, n.Name)
+		fmt.Fprintf(p.w, "@%d", n.Index)
+	case *Unpack:
+		fmt.Fprint(p.w, "var (")
+		for i, v := range n.Vars {
+			if i > 0 {
+				fmt.Fprint(p.w, ", ")
+			}
+			p.printVar(v.(*Var), indent)
+		}
+		fmt.Fprint(p.w, ") = ")
+		p.printAt(indent, n.Value)
 	case *Value:
 		switch v := n.Value.(type) {
+		case float64:
+			fmt.Fprint(p.w, formatFloat(v))
 		case string:
 			PrintEscapedString(p.w, v)
 		default:
 			fmt.Fprintf(p.w, "%v", n.Value)
 		}
 	case *Var:
-		fmt.Fprint(p.w, "var ")
+		switch {
+		case n.Flags&NodeFlagConst > 0:
+			fmt.Fprint(p.w, "const ")
+		case n.Flags&NodeFlagChange > 0:
+			fmt.Fprint(p.w, "change var ")
+		default:
+			fmt.Fprint(p.w, "var ")
+		}
 		p.printVar(n, indent)
+	case *Vartype:
+		fmt.Fprintf(p.w, "vartype@%d", n.Index)
+		fmt.Fprintln(p.w)
+		for _, kid := range n.Kids {
+			PrintIndent(p.w, indent+1)
+			p.printVar(kid.(*Var), indent+1)
+			fmt.Fprintln(p.w)
+		}
+		PrintIndent(p.w, indent)
+		fmt.Fprint(p.w, "end")
+	}
+}
+
+// Visits each direct kid of node that's present.
+func eachKid(node Node, visit func(Node)) {
+	kids := func(nodes ...Node) {
+		for _, n := range nodes {
+			if n != nil {
+				visit(n)
+			}
+		}
+	}
+	switch n := node.(type) {
+	case *Assign:
+		kids(n.Target, n.Value)
+	case *Block:
+		kids(n.Kids...)
+	case *Call:
+		kids(n.Callee)
+		kids(n.Args...)
+	case *Case:
+		kids(n.Patterns...)
+		kids(n.Gate)
+		kids(n.Kids...)
+	case *Cast:
+		kids(n.Subject, n.TypeSpec)
+	case *For:
+		kids(n.Item, n.Subject)
+		kids(n.Kids...)
+	case *Fun:
+		kids(n.TypeParams...)
+		kids(n.Params...)
+		kids(n.RetSpec)
+		kids(n.Kids...)
+	case *FunSpec:
+		kids(n.Params...)
+		kids(n.RetSpec)
+	case *Get:
+		kids(n.Subject, n.Member)
+	case *List:
+		kids(n.Items...)
+	case *Logic:
+		kids(n.Args...)
+	case *Maybe:
+		kids(n.Item)
+	case *Record:
+		kids(n.TypeParams...)
+		kids(n.Params...)
+		kids(n.Kids...)
+	case *Return:
+		kids(n.Value)
+	case *Switch:
+		kids(n.Subject)
+		kids(n.Kids...)
+	case *Try:
+		kids(n.Subject, n.Error)
+		kids(n.Kids...)
+	case *Tuple:
+		kids(n.Items...)
+	case *Unpack:
+		kids(n.Value)
+		kids(n.Vars...)
+	case *Var:
+		kids(n.TypeSpec, n.Value)
+	case *Vartype:
+		kids(n.Kids...)
 	}
 }
 
 func (p *treePrinting) printFunLabel(f *Fun) {
-	if f.Name != "" {
+	if f.Receiver != nil {
+		fmt.Fprintf(p.w, " %s&.%s", f.Receiver.(*Ref).Name, f.Name)
+	} else if f.Name != "" {
 		fmt.Fprintf(p.w, " %s", f.Name)
 	}
 	fmt.Fprintf(p.w, "@%d", f.Index)
 }
 
+func (p *treePrinting) printTypeParams(params []Node) {
+	for i, param := range params {
+		switch i {
+		case 0:
+			fmt.Fprint(p.w, "[")
+		default:
+			fmt.Fprint(p.w, ", ")
+		}
+		p.printAt(0, param)
+		if i == len(params)-1 {
+			fmt.Fprint(p.w, "]")
+		}
+	}
+}
+
 func (p *treePrinting) printKids(indent int, kids []Node, endless bool) {
 	fmt.Fprintln(p.w)
 	nextIndent := indent + 1
@@ -317,18 +834,62 @@ func (p *treePrinting) printKids(indent int, kids []Node, endless bool) {
 }
 
 func (p *treePrinting) printType(t Type) {
+	fmt.Fprintf(p.w, " %s", typeName(t))
+}
+
+func typeName(t Type) string {
 	switch t {
 	case nil:
-		fmt.Fprint(p.w, " Unknown")
+		return "Unknown"
+	case TypeAny:
+		return "Any"
+	case TypeBool:
+		return "Bool"
+	case TypeFloat:
+		return "Float"
 	case TypeInt:
-		fmt.Fprint(p.w, " Int")
+		return "Int"
+	case TypeNever:
+		return "Never"
 	case TypeNone:
-		fmt.Fprint(p.w, " Invalid")
+		return "Invalid"
 	case TypeString:
-		fmt.Fprint(p.w, " String")
-	default:
-		fmt.Fprint(p.w, " SomeType")
+		return "String"
+	case TypeVoid:
+		return "Void"
 	}
+	switch t := t.(type) {
+	case EitherType:
+		if t.NoType == TypeVoid {
+			return "?" + typeName(t.YesType)
+		}
+		return typeName(t.YesType) + " | " + typeName(t.NoType)
+	case *FunType:
+		params := make([]string, len(t.ParamTypes))
+		for i, param := range t.ParamTypes {
+			params[i] = typeName(param)
+		}
+		return "fun(" + strings.Join(params, ", ") + ") " + typeName(t.RetType)
+	case ListType:
+		return "*" + typeName(t.ItemType)
+	case *AppliedType:
+		args := make([]string, len(t.Args))
+		for i, arg := range t.Args {
+			args[i] = typeName(arg)
+		}
+		return t.Record.Name + "[" + strings.Join(args, ", ") + "]"
+	case *Record:
+		return t.Name
+	case *TupleType:
+		items := make([]string, len(t.ItemTypes))
+		for i, item := range t.ItemTypes {
+			items[i] = typeName(item)
+		}
+		return "(" + strings.Join(items, ", ") + ")"
+	case *TypeParam:
+		return t.Name
+	}
+	return "SomeType"
 }
 
 func (p *treePrinting) printVar(n *Var, indent int) {
@@ -357,9 +918,7 @@ func PrintEscapedString(w io.Writer, s string) {
 		default:
 			switch {
 			case r < 0x20 || r > 0x7e:
-				fmt.Fprint(w, "\\u(")
-				fmt.Fprintf(w, "%x", r)
-				fmt.Fprint(w, ')')
+				fmt.Fprintf(w, "\\u(%x)", r)
 			default:
 				fmt.Fprintf(w, "%c", r)
 			}
@@ -369,21 +928,37 @@ func PrintEscapedString(w io.Writer, s string) {
 }
 
 type treeBuilder struct {
-	nodes    []inNode   // TODO convert to array of interface later?
-	infos    []NodeInfo // Same length as nodes.
-	blocks   []inBlock
-	calls    []inCall
-	cases    []inCase
-	funs     []inFun
-	gets     []inGet
-	refs     []string
-	returns  []inReturn
-	values   []any
-	vars     []inVar // TODO Also workVars for contiguous params?
-	work     []inNode
-	workInfo []NodeInfo // Same length as work.
-	source   Source
-	switches []inSwitch
+	nodes      []inNode   // TODO convert to array of interface later?
+	infos      []NodeInfo // Same length as nodes.
+	assigns    []inAssign
+	blocks     []inBlock
+	calls      []inCall
+	cases      []inCase
+	casts      []inCast
+	fors       []inFor
+	funs       []inFun
+	funSpecs   []inFunSpec
+	gets       []inGet
+	imports    []inImport
+	lists      []inList
+	logics     []inLogic
+	maybes     []inMaybe
+	problems   []inProblem
+	records    []inRecord
+	refs       []string
+	returns    []inReturn
+	tags       []string
+	tries      []inTry
+	tuples     []inTuple
+	typeParams []string
+	unpacks    []inUnpack
+	values     []any
+	vars       []inVar // TODO Also workVars for contiguous params?
+	vartypes   []inVartype
+	work       []inNode
+	workInfo   []NodeInfo // Same length as work.
+	source     Source
+	switches   []inSwitch
 }
 
 type inNode struct {
@@ -391,6 +966,11 @@ type inNode struct {
 	index int // array depends on Kind
 }
 
+type inAssign struct {
+	target Idx[inNode]
+	value  Idx[inNode]
+}
+
 type inBlock struct {
 	kids Range[inNode]
 }
@@ -407,18 +987,72 @@ type inCase struct {
 	kids     Range[inNode]
 }
 
+type inCast struct {
+	kind    TokenKind
+	subject Idx[inNode]
+	spec    Idx[inNode]
+}
+
+type inFor struct {
+	Def
+	item    Idx[inNode]
+	subject Idx[inNode]
+	kids    Range[inNode]
+}
+
 type inFun struct {
 	Def
-	params Range[inNode]
+	receiver   Idx[inNode]
+	typeParams Range[inNode]
+	params     Range[inNode]
 	// ret Idx[inNode]
 	kids Range[inNode]
 }
 
+type inFunSpec struct {
+	params Range[inNode]
+	ret    Idx[inNode]
+}
+
 type inGet struct {
 	subject Idx[inNode]
 	member  Idx[inNode]
 }
 
+type inImport struct {
+	Def
+	from Idx[inNode]
+	path string
+	uses []Use
+}
+
+type inList struct {
+	items Range[inNode]
+}
+
+type inLogic struct {
+	kind TokenKind
+	args Range[inNode]
+}
+
+type inMaybe struct {
+	item Idx[inNode]
+}
+
+// Found during norm, for the node once committed.
+type inProblem struct {
+	node    inNode
+	message string
+}
+
+type inRecord struct {
+	Def
+	kind       TokenKind
+	typeParams Range[inNode]
+	params     Range[inNode]
+	kids       Range[inNode]
+}
+
 type inReturn struct {
 	kind  TokenKind
 	label Idx[inNode] // Required for break.
@@ -430,24 +1064,57 @@ type inSwitch struct {
 	kids    Range[inNode]
 }
 
+type inTry struct {
+	handled bool
+	subject Idx[inNode]
+	error   Idx[inNode]
+	kids    Range[inNode]
+}
+
+type inTuple struct {
+	items Range[inNode]
+}
+
+type inUnpack struct {
+	vars  Range[inNode]
+	value Idx[inNode]
+}
+
 type inVar struct {
 	Def
 	typ   Idx[inNode]
 	value Idx[inNode]
 }
 
+type inVartype struct {
+	kids Range[inNode]
+}
+
 func newTreeBuilder() treeBuilder {
 	// Init some with bogus at index 0 so valid are always nonzero.
 	return treeBuilder{
 		nodes:    make([]inNode, 1),
 		infos:    make([]NodeInfo, 1),
+		assigns:  make([]inAssign, 1),
 		cases:    make([]inCase, 1),
+		casts:    make([]inCast, 1),
 		blocks:   make([]inBlock, 1),
+		fors:     make([]inFor, 1),
 		funs:     make([]inFun, 1),
+		funSpecs: make([]inFunSpec, 1),
 		gets:     make([]inGet, 1),
+		imports:  make([]inImport, 1),
+		lists:    make([]inList, 1),
+		logics:   make([]inLogic, 1),
+		maybes:   make([]inMaybe, 1),
+		records:  make([]inRecord, 1),
 		returns:  make([]inReturn, 1),
 		switches: make([]inSwitch, 1),
+		tries:    make([]inTry, 1),
+		tuples:   make([]inTuple, 1),
+		unpacks:  make([]inUnpack, 1),
 		vars:     make([]inVar, 1),
+		vartypes: make([]inVartype, 1),
 	}
 }
 
@@ -456,16 +1123,32 @@ func (b *treeBuilder) reset() {
 	// TODO Any changes needed here?
 	b.nodes = b.nodes[:1]
 	b.infos = b.infos[:1]
+	b.assigns = b.assigns[:1]
 	b.blocks = b.blocks[:1]
 	b.cases = b.cases[:1]
+	b.casts = b.casts[:1]
+	b.fors = b.fors[:1]
 	b.funs = b.funs[:1]
+	b.funSpecs = b.funSpecs[:1]
 	b.gets = b.gets[:1]
+	b.imports = b.imports[:1]
+	b.lists = b.lists[:1]
+	b.logics = b.logics[:1]
+	b.maybes = b.maybes[:1]
+	b.records = b.records[:1]
 	b.returns = b.returns[:1]
 	b.vars = b.vars[:1]
+	b.vartypes = b.vartypes[:1]
 	b.switches = b.switches[:1]
+	b.tries = b.tries[:1]
+	b.tuples = b.tuples[:1]
+	b.unpacks = b.unpacks[:1]
 	// Start at 0. TODO Should these start at 1 also?
 	b.calls = b.calls[:0]
 	b.refs = b.refs[:0]
+	b.tags = b.tags[:0]
+	b.typeParams = b.typeParams[:0]
+	b.problems = b.problems[:0]
 	b.work = b.work[:0]
 	b.workInfo = b.workInfo[:0]
 	b.source = Source{}
@@ -482,38 +1165,89 @@ func (b *treeBuilder) toTree() *Module {
 	// log.Printf("tokens: %+v\n", b.tokens)
 	// log.Printf("vars: %+v\n", b.vars)
 	nodes := make([]Node, len(b.nodes))
+	assigns := make([]Assign, len(b.assigns))
 	blocks := make([]Block, len(b.blocks))
 	calls := make([]Call, len(b.calls))
 	cases := make([]Case, len(b.cases))
+	casts := make([]Cast, len(b.casts))
+	fors := make([]For, len(b.fors))
 	funs := make([]Fun, len(b.funs))
+	funSpecs := make([]FunSpec, len(b.funSpecs))
 	gets := make([]Get, len(b.gets))
+	imports := make([]Import, len(b.imports))
+	lists := make([]List, len(b.lists))
+	logics := make([]Logic, len(b.logics))
+	maybes := make([]Maybe, len(b.maybes))
+	records := make([]Record, len(b.records))
 	refs := make([]Ref, len(b.refs))
 	returns := make([]Return, len(b.returns))
 	switches := make([]Switch, len(b.switches))
+	tags := make([]Tag, len(b.tags))
+	tries := make([]Try, len(b.tries))
+	tuples := make([]Tuple, len(b.tuples))
+	typeParams := make([]TypeParam, len(b.typeParams))
+	unpacks := make([]Unpack, len(b.unpacks))
 	values := make([]Value, len(b.values))
 	vars := make([]Var, len(b.vars))
+	vartypes := make([]Vartype, len(b.vartypes))
 	for i, node := range b.nodes {
 		switch node.kind {
+		case NodeAssign:
+			nodes[i] = &assigns[node.index]
 		case NodeBlock:
 			nodes[i] = &blocks[node.index]
 		case NodeCall:
 			nodes[i] = &calls[node.index]
 		case NodeCase:
 			nodes[i] = &cases[node.index]
+		case NodeCast:
+			nodes[i] = &casts[node.index]
+		case NodeFor:
+			nodes[i] = &fors[node.index]
 		case NodeFun:
 			nodes[i] = &funs[node.index]
+		case NodeFunSpec:
+			nodes[i] = &funSpecs[node.index]
 		case NodeGet:
 			nodes[i] = &gets[node.index]
+		case NodeImport:
+			nodes[i] = &imports[node.index]
+		case NodeList:
+			nodes[i] = &lists[node.index]
+		case NodeLogic:
+			nodes[i] = &logics[node.index]
+		case NodeMaybe:
+			nodes[i] = &maybes[node.index]
+		case NodeRecord:
+			nodes[i] = &records[node.index]
 		case NodeRef:
 			nodes[i] = &refs[node.index]
 		case NodeReturn:
 			nodes[i] = &returns[node.index]
 		case NodeSwitch:
 			nodes[i] = &switches[node.index]
+		case NodeTag:
+			nodes[i] = &tags[node.index]
+		case NodeTry:
+			nodes[i] = &tries[node.index]
+		case NodeTuple:
+			nodes[i] = &tuples[node.index]
+		case NodeTypeParam:
+			nodes[i] = &typeParams[node.index]
+		case NodeUnpack:
+			nodes[i] = &unpacks[node.index]
 		case NodeValue:
 			nodes[i] = &values[node.index]
 		case NodeVar:
 			nodes[i] = &vars[node.index]
+		case NodeVartype:
+			nodes[i] = &vartypes[node.index]
+		}
+	}
+	for i, a := range b.assigns {
+		assigns[i] = Assign{
+			Target: nodes[a.target],
+			Value:  nodes[a.value],
 		}
 	}
 	for i, b := range b.blocks {
@@ -535,11 +1269,34 @@ func (b *treeBuilder) toTree() *Module {
 			Kids:     Slice(c.kids, nodes),
 		}
 	}
+	for i, c := range b.casts {
+		casts[i] = Cast{
+			Kind:     c.kind,
+			Subject:  nodes[c.subject],
+			TypeSpec: nodes[c.spec],
+		}
+	}
+	for i, f := range b.fors {
+		fors[i] = For{
+			Def:     f.Def,
+			Item:    nodes[f.item],
+			Subject: nodes[f.subject],
+			Kids:    Slice(f.kids, nodes),
+		}
+	}
 	for i, f := range b.funs {
 		funs[i] = Fun{
-			Def:    f.Def,
-			Params: Slice(f.params, nodes),
-			Kids:   Slice(f.kids, nodes),
+			Def:        f.Def,
+			Receiver:   nodes[f.receiver],
+			TypeParams: Slice(f.typeParams, nodes),
+			Params:     Slice(f.params, nodes),
+			Kids:       Slice(f.kids, nodes),
+		}
+	}
+	for i, f := range b.funSpecs {
+		funSpecs[i] = FunSpec{
+			Params:  Slice(f.params, nodes),
+			RetSpec: nodes[f.ret],
 		}
 	}
 	for i, g := range b.gets {
@@ -548,6 +1305,39 @@ func (b *treeBuilder) toTree() *Module {
 			Member:  nodes[g.member],
 		}
 	}
+	for i, imp := range b.imports {
+		imports[i] = Import{
+			Def:  imp.Def,
+			From: nodes[imp.from],
+			Path: imp.path,
+			Uses: imp.uses,
+		}
+	}
+	for i, l := range b.lists {
+		lists[i] = List{
+			Items: Slice(l.items, nodes),
+		}
+	}
+	for i, l := range b.logics {
+		logics[i] = Logic{
+			Kind: l.kind,
+			Args: Slice(l.args, nodes),
+		}
+	}
+	for i, m := range b.maybes {
+		maybes[i] = Maybe{
+			Item: nodes[m.item],
+		}
+	}
+	for i, r := range b.records {
+		records[i] = Record{
+			Def:        r.Def,
+			Kind:       r.kind,
+			TypeParams: Slice(r.typeParams, nodes),
+			Params:     Slice(r.params, nodes),
+			Kids:       Slice(r.kids, nodes),
+		}
+	}
 	for i, ref := range b.refs {
 		refs[i] = Ref{
 			Name: ref,
@@ -566,6 +1356,36 @@ func (b *treeBuilder) toTree() *Module {
 			Kids:    Slice(s.kids, nodes),
 		}
 	}
+	for i, tag := range b.tags {
+		tags[i] = Tag{
+			Def: Def{Name: tag},
+		}
+	}
+	for i, t := range b.tries {
+		tries[i] = Try{
+			Handled: t.handled,
+			Subject: nodes[t.subject],
+			Error:   nodes[t.error],
+			Kids:    Slice(t.kids, nodes),
+		}
+	}
+	for i, t := range b.tuples {
+		tuples[i] = Tuple{
+			Items: Slice(t.items, nodes),
+		}
+	}
+	for i, param := range b.typeParams {
+		typeParams[i] = TypeParam{
+			Def: Def{Name: param},
+		}
+		typeParams[i].Meta.Type = &typeParams[i]
+	}
+	for i, u := range b.unpacks {
+		unpacks[i] = Unpack{
+			Vars:  Slice(u.vars, nodes),
+			Value: nodes[u.value],
+		}
+	}
 	for i, v := range b.values {
 		values[i] = Value{
 			Value: v,
@@ -573,12 +1393,21 @@ func (b *treeBuilder) toTree() *Module {
 	}
 	for i, v := range b.vars {
 		vars[i] = Var{
-			Def:   v.Def,
-			Value: nodes[v.value],
+			Def:      v.Def,
+			TypeSpec: nodes[v.typ],
+			Value:    nodes[v.value],
+		}
+	}
+	for i, v := range b.vartypes {
+		vartypes[i] = Vartype{
+			Kids: Slice(v.kids, nodes),
 		}
 	}
 	for i, node := range b.nodes {
 		switch node.kind {
+		case NodeAssign:
+			a := &assigns[node.index]
+			a.Index = i
 		case NodeBlock:
 			b := &blocks[node.index]
 			b.Index = i
@@ -588,12 +1417,36 @@ func (b *treeBuilder) toTree() *Module {
 		case NodeCase:
 			c := &cases[node.index]
 			c.Index = i
+		case NodeCast:
+			c := &casts[node.index]
+			c.Index = i
+		case NodeFor:
+			f := &fors[node.index]
+			f.Index = i
 		case NodeFun:
 			f := &funs[node.index]
 			f.Index = i
+		case NodeFunSpec:
+			f := &funSpecs[node.index]
+			f.Index = i
 		case NodeGet:
 			g := &gets[node.index]
 			g.Index = i
+		case NodeImport:
+			imp := &imports[node.index]
+			imp.Index = i
+		case NodeList:
+			l := &lists[node.index]
+			l.Index = i
+		case NodeLogic:
+			l := &logics[node.index]
+			l.Index = i
+		case NodeMaybe:
+			m := &maybes[node.index]
+			m.Index = i
+		case NodeRecord:
+			r := &records[node.index]
+			r.Index = i
 		case NodeRef:
 			ref := &refs[node.index]
 			ref.Index = i
@@ -603,12 +1456,30 @@ func (b *treeBuilder) toTree() *Module {
 		case NodeSwitch:
 			s := &switches[node.index]
 			s.Index = i
+		case NodeTag:
+			t := &tags[node.index]
+			t.Index = i
+		case NodeTry:
+			t := &tries[node.index]
+			t.Index = i
+		case NodeTuple:
+			t := &tuples[node.index]
+			t.Index = i
+		case NodeTypeParam:
+			t := &typeParams[node.index]
+			t.Index = i
+		case NodeUnpack:
+			u := &unpacks[node.index]
+			u.Index = i
 		case NodeValue:
 			v := &values[node.index]
 			v.Index = i
 		case NodeVar:
 			v := &vars[node.index]
 			v.Index = i
+		case NodeVartype:
+			v := &vartypes[node.index]
+			v.Index = i
 		}
 	}
 	// log.Printf("copy done\n")
@@ -618,10 +1489,16 @@ func (b *treeBuilder) toTree() *Module {
 	// log.Printf("funs: %+v\n", funs)
 	// log.Printf("tokens: %+v\n", tokens)
 	// log.Printf("vars: %+v\n", vars)
-	return &Module{
+	module := &Module{
 		Core: map[string]Node{},
 		Root: nodes[len(nodes)-1],
 	}
+	for _, p := range b.problems {
+		if i := slices.Index(b.nodes, p.node); i >= 0 {
+			module.problem(i, p.message)
+		}
+	}
+	return module
 }
 
 func (b *treeBuilder) commitHeadless(start int) {
@@ -1,11 +1,22 @@
 package rio
 
 import (
+	"fmt"
+	"slices"
+	"sync"
 	"unique"
 )
 
 func (t *typer) Type(m *Module) {
+	if t.applied == nil {
+		t.applied = make(map[Pair[Type, Type]]*AppliedType)
+	}
 	t.funTypes = t.funTypes[:0]
+	t.funs = t.funs[:0]
+	t.try = nil
+	t.module = m
+	t.narrows = t.narrows[:0]
+	t.pattern = nil
 	t.typeTypes = t.typeTypes[:0]
 	t.typeRoot(m.Root.(*Block))
 }
@@ -40,55 +51,222 @@ const (
 
 //go:generate stringer -type=BaseType
 
+// Optional types have NoType void, since none is the void value. Values of
+// either side are never boxed.
 type EitherType struct {
 	YesType Type
 	NoType  Type
 }
 
 type FunType struct {
+	Fails      bool // so calls need try
 	ParamTypes []Type
 	RetType    Type
+	TypeParams []*TypeParam // inferred at each call
+	YieldType  Type         // from yields directly inside, if any
+}
+
+// Generic record with type args, as in `Stack[Int]`, interned so that equal
+// applications are the same pointer.
+type AppliedType struct {
+	Record *Record
+	Args   []Type
 }
 
 type ListType struct {
 	ItemType Type
 }
 
+// Fixed group of item types, as in `(Int, String)`, interned by tupleOf so
+// that equal tuples are the same pointer.
+type TupleType struct {
+	ItemTypes []Type
+}
+
 type TypeType struct {
 	Type Type
 }
 
+// Interned tuple types, chained by each item in turn. These are shared across
+// typers, since core funs can also return tuples.
+var tupleTypes = struct {
+	sync.Mutex
+	m map[Pair[Type, Type]]*TupleType
+}{m: map[Pair[Type, Type]]*TupleType{}}
+
+// Gives the interned tuple of the item types, which should be at least two.
+func tupleOf(items ...Type) *TupleType {
+	tupleTypes.Lock()
+	defer tupleTypes.Unlock()
+	var key Type
+	var tuple *TupleType
+	for i, item := range items {
+		pair := Pair[Type, Type]{key, item}
+		tuple = tupleTypes.m[pair]
+		if tuple == nil {
+			tuple = &TupleType{ItemTypes: slices.Clone(items[:i+1])}
+			tupleTypes.m[pair] = tuple
+		}
+		key = tuple
+	}
+	return tuple
+}
+
+// Finds a type covering both branches, where never yields to anything.
+func joinTypes(a, b Type) Type {
+	// Unknown might be filled in on another pass, so go with what we know.
+	switch {
+	case a == b || b == nil || b == TypeNever:
+		return a
+	case a == nil || a == TypeNever:
+		return b
+	case a == TypeVoid || b == maybeType(a):
+		return maybeType(b)
+	case b == TypeVoid || a == maybeType(b):
+		return maybeType(a)
+	}
+	return TypeAny
+}
+
+// Gives the optional form of a type, without nesting.
+func maybeType(t Type) Type {
+	switch t {
+	case nil, TypeAny, TypeNever, TypeVoid:
+		return t
+	}
+	if either, ok := t.(EitherType); ok && either.NoType == TypeVoid {
+		return t
+	}
+	return EitherType{YesType: t, NoType: TypeVoid}
+}
+
+// Gives the type of present values for optional types.
+func presentType(t Type) (Type, bool) {
+	if either, ok := t.(EitherType); ok && either.NoType == TypeVoid {
+		return either.YesType, true
+	}
+	return t, false
+}
+
+// Gives the type of items from iterating over the given type.
+// Gives the type of items from iterating t, and whether it can be iterated.
+func itemType(t Type) (Type, bool) {
+	switch t {
+	case nil, TypeAny, TypeNever:
+		// Unknown until run.
+		return nil, true
+	case TypeInt:
+		// Counting up from zero.
+		return TypeInt, true
+	}
+	switch t := t.(type) {
+	case *AppliedType:
+		if t.Record == coroutineType {
+			// Yielded values until done.
+			return t.Args[0], true
+		}
+	case ListType:
+		return t.ItemType, true
+	}
+	return nil, false
+}
+
 type typer struct {
+	// Interned type applications, chained by record then each arg in turn.
+	applied map[Pair[Type, Type]]*AppliedType
 	// Stack of wanted types by labeled blocks/functions.
 	// TODO Also stack of found types for the same.
-	funTypes  []FunType
+	funTypes []FunType
+	funs     []*Fun // being typed, innermost last
+	module   *Module
+	// Var types narrowed inside switch cases, innermost last.
+	narrows []Pair[*Var, Type]
+	// Case pattern being typed, which reports its own payload count.
+	pattern Node
+	// Innermost try covering the current expression, if any.
+	try       *Try
 	typeTypes []TypeType
+	// Vars from vartype declarations in scope, innermost last.
+	vartypes []*Var
 }
 
 func (t *typer) typeRoot(b *Block) {
+	t.vartypes = t.vartypes[:0]
+	if !t.pushVartypes(b.Kids) {
+		// Modules without their own vartype get the letter defaults.
+		t.vartypes = append(t.vartypes, defaultVartype...)
+	}
 	for _, n := range b.Kids {
 		t.typeNode(n, nil)
 	}
 }
 
+// Pushes any vartypes declared among kids, which apply throughout the
+// scope, and says if any were found.
+func (t *typer) pushVartypes(kids []Node) bool {
+	found := false
+	for _, kid := range kids {
+		if vartype, ok := kid.(*Vartype); ok {
+			found = true
+			for _, v := range vartype.Kids {
+				t.typeNode(v, nil)
+				t.vartypes = append(t.vartypes, v.(*Var))
+			}
+		}
+	}
+	return found
+}
+
+// Gives the type for the name from the nearest vartype, if any.
+func (t *typer) vartypeOf(name string) Type {
+	for i := len(t.vartypes) - 1; i >= 0; i-- {
+		if v := t.vartypes[i]; v.Name == name {
+			return v.Type
+		}
+	}
+	return nil
+}
+
 func (t *typer) typeNode(node Node, wanted Type) Type {
 	switch n := node.(type) {
+	case *Assign:
+		return t.typeAssign(n, wanted)
 	case *Block:
 		return t.typeBlock(n, wanted)
 	case *Call:
 		return t.typeCall(n, wanted)
 	case *Case:
-		return t.typeCase(n, wanted, nil)
+		return t.typeCase(n, wanted, nil, nil)
+	case *Cast:
+		return t.typeCast(n, wanted)
+	case *For:
+		return t.typeFor(n, wanted)
 	case *Fun:
 		return t.typeFun(n, wanted)
+	case *FunSpec:
+		return t.typeFunSpec(n, wanted)
 	case *Get:
 		return t.typeGet(n, wanted)
+	case *List:
+		return t.typeList(n, wanted)
+	case *Logic:
+		return t.typeLogic(n, wanted)
+	case *Maybe:
+		return t.typeMaybe(n, wanted)
+	case *Record:
+		return t.typeRecord(n, wanted)
 	case *Ref:
 		return t.typeRef(n, wanted)
 	case *Return:
 		return t.typeReturn(n, wanted)
 	case *Switch:
 		return t.typeSwitch(n, wanted)
+	case *Try:
+		return t.typeTry(n, wanted)
+	case *Tuple:
+		return t.typeTuple(n, wanted)
+	case *Unpack:
+		return t.typeUnpack(n, wanted)
 	case *Value:
 		return t.typeValue(n, wanted)
 	case *Var:
@@ -97,11 +275,92 @@ func (t *typer) typeNode(node Node, wanted Type) Type {
 	return nil
 }
 
+func (t *typer) typeAssign(a *Assign, wanted Type) Type {
+	_ = wanted
+	targetType := t.typeNode(a.Target, nil)
+	switch target := a.Target.(type) {
+	case *Get:
+		switch memberTarget(target).(type) {
+		case nil, *Var:
+		default:
+			t.module.problem(a.Index, "not a field: "+target.Member.(*Ref).Name)
+		}
+		// Only known once we know the subject type.
+		if v := t.changeHolder(target); v != nil && v.Flags&NodeFlagChange == 0 {
+			t.module.problem(a.Index, "var not changeable: "+v.Name)
+		}
+	case *Ref:
+		// Non-vars are reported during resolve.
+	default:
+		t.module.problem(a.Index, "not assignable")
+		return nil
+	}
+	valueType := t.typeNode(a.Value, targetType)
+	if !fits(valueType, targetType) {
+		t.module.problem(a.Index, fmt.Sprintf(
+			"wrong assign type: got %s, want %s",
+			typeName(valueType), typeName(targetType),
+		))
+	}
+	return valueType
+}
+
+// Finds the var that must be changeable to assign through a get. Struct
+// fields change along with whatever holds the struct.
+func (t *typer) changeHolder(get *Get) *Var {
+	if isStruct(t.typeNode(get.Subject, nil)) {
+		switch subject := get.Subject.(type) {
+		case *Get:
+			return t.changeHolder(subject)
+		case *Ref:
+			v, _ := subject.Target.(*Var)
+			if v != nil && v.Flags&NodeFlagTemp != 0 {
+				// Temps stand in for their value.
+				if value, ok := v.Value.(*Get); ok {
+					return t.changeHolder(value)
+				}
+				return nil
+			}
+			return v
+		}
+		return nil
+	}
+	v, _ := memberTarget(get).(*Var)
+	return v
+}
+
+// Says if vars of type t can start without a value, as zeroValue knows how.
+func hasZero(t Type) bool {
+	switch t {
+	case nil, TypeAny, TypeBool, TypeFloat, TypeInt, TypeString:
+		return true
+	}
+	if _, maybe := presentType(t); maybe {
+		// Starts as none.
+		return true
+	}
+	switch t := t.(type) {
+	case ListType:
+		return true
+	case *Record:
+		return t.Kind == TokenStruct
+	}
+	return false
+}
+
+func isStruct(t Type) bool {
+	rec, ok := methodsOf(t).(*Record)
+	return ok && rec.Kind == TokenStruct
+}
+
 func (t *typer) typeBlock(b *Block, wanted Type) Type {
 	return t.typeBlockKids(b.Kids, wanted)
 }
 
 func (t *typer) typeBlockKids(kids []Node, wanted Type) Type {
+	vartypesLen := len(t.vartypes)
+	defer func() { t.vartypes = t.vartypes[:vartypesLen] }()
+	t.pushVartypes(kids)
 	var typ Type = TypeVoid
 	var kidWanted Type
 	for i, n := range kids {
@@ -110,7 +369,7 @@ func (t *typer) typeBlockKids(kids []Node, wanted Type) Type {
 		if i == len(kids)-1 {
 			kidWanted = wanted
 		}
-		nodeType := t.typeNode(n, kidWanted)
+		nodeType := t.typeKid(n, kidWanted)
 		if typ != TypeNever {
 			// TODO Also only needed for last node, but meh.
 			typ = nodeType
@@ -119,37 +378,650 @@ func (t *typer) typeBlockKids(kids []Node, wanted Type) Type {
 	return typ
 }
 
+// Types a statement in a body, where vars without values start at zero.
+func (t *typer) typeKid(n Node, wanted Type) Type {
+	typ := t.typeNode(n, wanted)
+	if v, ok := n.(*Var); ok && v.Value == nil && !hasZero(v.Type) {
+		t.module.problem(v.Index, "var needs a value: "+v.Name)
+	}
+	return typ
+}
+
 func (t *typer) typeCall(c *Call, wanted Type) Type {
+	if applied := t.typeApplication(c, wanted); applied != nil {
+		return applied
+	}
 	wantedFunType := push(&t.funTypes, FunType{RetType: wanted})
 	defer pop(&t.funTypes)
 	calleeType := t.typeNode(c.Callee, wantedFunType)
-	// TODO If callee is a get, avoid binding of type?
 	var retType Type
+	var bindings map[*TypeParam]Type
 	funType, ok := calleeType.(*FunType)
+	if ok && funType.Fails {
+		t.callFails(c)
+	}
 	if ok {
 		retType = funType.RetType
+		if len(funType.TypeParams) > 0 {
+			// Infer type args from what's wanted, then from each arg.
+			bindings = make(map[*TypeParam]Type, len(funType.TypeParams))
+			for _, param := range funType.TypeParams {
+				bindings[param] = nil
+			}
+			unify(funType.RetType, wanted, bindings)
+		}
+	}
+	// Methods take their subject as the first param.
+	offset := 0
+	get, isGet := c.Callee.(*Get)
+	if isGet && t.isMethodGet(get) {
+		offset = 1
+	}
+	if ok && Node(c) != t.pattern {
+		if len(c.Args)+offset != len(funType.ParamTypes) {
+			t.module.problem(c.Index, fmt.Sprintf(
+				"wrong arg count: got %d, want %d",
+				len(c.Args), len(funType.ParamTypes)-offset,
+			))
+		}
 	}
 	for i, a := range c.Args {
-		// TODO If avoid binding, skip first.
 		var paramType Type
-		if ok && i < len(funType.ParamTypes) {
-			paramType = funType.ParamTypes[i]
+		if ok && i+offset < len(funType.ParamTypes) {
+			paramType = t.bindType(funType.ParamTypes[i+offset], bindings)
+		}
+		argType := t.typeNode(a, paramType)
+		if bindings != nil && i+offset < len(funType.ParamTypes) {
+			if !unify(funType.ParamTypes[i+offset], argType, bindings) {
+				// Already bound by what's wanted or by an earlier arg.
+				t.module.problem(c.Index, fmt.Sprintf(
+					"conflicting type arg: got %s, want %s",
+					typeName(argType), typeName(paramType),
+				))
+				continue
+			}
+			paramType = t.bindType(funType.ParamTypes[i+offset], bindings)
+		}
+		if !fits(argType, paramType) {
+			// Even numbers only convert explicitly, as with `i.toFloat()`.
+			t.module.problem(c.Index, fmt.Sprintf(
+				"wrong arg type: got %s, want %s",
+				typeName(argType), typeName(paramType),
+			))
+		}
+		if isGet && i == 0 && memberTarget(get) == listMap {
+			// Mapped items are whatever the fun returns.
+			if argFunType, ok := argType.(*FunType); ok {
+				retType = ListType{ItemType: argFunType.RetType}
+			}
+		}
+		if isGet && i == 0 && memberTarget(get) == tupleGet && ok {
+			// Items differ in type, so the index must be known.
+			tuple, _ := funType.ParamTypes[0].(*TupleType)
+			retType = t.tupleItemType(c, tuple, a)
 		}
-		t.typeNode(a, paramType)
+	}
+	if bindings != nil {
+		retType = t.bindType(funType.RetType, bindings)
 	}
 	return retType
 }
 
-func (t *typer) typeCase(c *Case, wanted Type, subjectWanted Type) Type {
+// Types generic record application in type position, as in `Stack[Int]`,
+// which arrives as a get call like other indexing.
+func (t *typer) typeApplication(c *Call, wanted Type) Type {
+	if _, ok := wanted.(*TypeType); !ok {
+		return nil
+	}
+	get, ok := c.Callee.(*Get)
+	if !ok {
+		return nil
+	}
+	if member, ok := get.Member.(*Ref); !ok || member.Name != "get" {
+		return nil
+	}
+	ref, ok := get.Subject.(*Ref)
+	if !ok {
+		return nil
+	}
+	rec, ok := ref.Target.(*Record)
+	if !ok || len(rec.TypeParams) == 0 {
+		return nil
+	}
+	if len(c.Args) != len(rec.TypeParams) {
+		t.module.problem(c.Index, "wrong type arg count: "+rec.Name)
+	}
+	argWanted := push(&t.typeTypes, TypeType{})
+	defer pop(&t.typeTypes)
+	args := make([]Type, len(rec.TypeParams))
+	for i, a := range c.Args {
+		spec, ok := t.typeNode(a, argWanted).(*TypeType)
+		if ok && i < len(args) {
+			args[i] = spec.Type
+		}
+	}
+	if rec == listType {
+		// Lists have their own type, as from `*Int`.
+		return &TypeType{Type: ListType{ItemType: args[0]}}
+	}
+	return &TypeType{Type: t.applyType(rec, args)}
+}
+
+// Gives the interned application of a generic record to type args.
+func (t *typer) applyType(rec *Record, args []Type) Type {
+	var key Type = rec
+	var applied *AppliedType
+	for i, arg := range args {
+		pair := Pair[Type, Type]{key, arg}
+		applied = t.applied[pair]
+		if applied == nil {
+			applied = &AppliedType{Record: rec, Args: slices.Clone(args[:i+1])}
+			t.applied[pair] = applied
+		}
+		key = applied
+	}
+	return applied
+}
+
+// Binds still free type params within param to matching parts of arg,
+// returning false if arg contradicts an existing binding.
+func unify(param, arg Type, bindings map[*TypeParam]Type) bool {
+	switch arg {
+	case nil, TypeAny, TypeNever:
+		// Nothing to learn, and Any would otherwise accept everything.
+		return true
+	}
+	ok := true
+	switch param := param.(type) {
+	case *AppliedType:
+		if arg, isApplied := arg.(*AppliedType); isApplied &&
+			arg.Record == param.Record {
+			for i, paramArg := range param.Args {
+				ok = unify(paramArg, arg.Args[i], bindings) && ok
+			}
+		}
+	case EitherType:
+		switch either := arg.(type) {
+		case EitherType:
+			ok = unify(param.YesType, either.YesType, bindings) && ok
+			ok = unify(param.NoType, either.NoType, bindings) && ok
+		default:
+			if param.NoType == TypeVoid && arg != TypeVoid {
+				// Present values also fit optional types.
+				ok = unify(param.YesType, arg, bindings)
+			}
+		}
+	case *FunType:
+		if arg, isFun := arg.(*FunType); isFun {
+			for i, paramParam := range param.ParamTypes {
+				if i < len(arg.ParamTypes) {
+					ok = unify(paramParam, arg.ParamTypes[i], bindings) && ok
+				}
+			}
+			ok = unify(param.RetType, arg.RetType, bindings) && ok
+			ok = unify(param.YieldType, arg.YieldType, bindings) && ok
+		}
+	case ListType:
+		if arg, isList := arg.(ListType); isList {
+			ok = unify(param.ItemType, arg.ItemType, bindings)
+		}
+	case *TupleType:
+		if arg, isTuple := arg.(*TupleType); isTuple {
+			for i, item := range param.ItemTypes {
+				if i < len(arg.ItemTypes) {
+					ok = unify(item, arg.ItemTypes[i], bindings) && ok
+				}
+			}
+		}
+	case *TypeParam:
+		bound, own := bindings[param]
+		switch {
+		case !own:
+		case bound == nil:
+			bindings[param] = arg
+		default:
+			ok = fits(arg, bound)
+		}
+	}
+	return ok
+}
+
+// Substitutes type args into typ, where params bound to nil are unknown.
+func (t *typer) bindType(typ Type, bindings map[*TypeParam]Type) Type {
+	if len(bindings) == 0 {
+		return typ
+	}
+	switch typ := typ.(type) {
+	case *AppliedType:
+		args := make([]Type, len(typ.Args))
+		for i, arg := range typ.Args {
+			args[i] = t.bindType(arg, bindings)
+		}
+		return t.applyType(typ.Record, args)
+	case EitherType:
+		yes := t.bindType(typ.YesType, bindings)
+		if typ.NoType == TypeVoid {
+			return maybeType(yes)
+		}
+		return EitherType{YesType: yes, NoType: t.bindType(typ.NoType, bindings)}
+	case *FunType:
+		bound := &FunType{
+			Fails:     typ.Fails,
+			RetType:   t.bindType(typ.RetType, bindings),
+			YieldType: t.bindType(typ.YieldType, bindings),
+		}
+		for _, param := range typ.ParamTypes {
+			bound.ParamTypes = append(bound.ParamTypes, t.bindType(param, bindings))
+		}
+		for _, param := range typ.TypeParams {
+			if _, ok := bindings[param]; !ok {
+				bound.TypeParams = append(bound.TypeParams, param)
+			}
+		}
+		return bound
+	case ListType:
+		return ListType{ItemType: t.bindType(typ.ItemType, bindings)}
+	case *TupleType:
+		items := make([]Type, len(typ.ItemTypes))
+		for i, item := range typ.ItemTypes {
+			items[i] = t.bindType(item, bindings)
+		}
+		return tupleOf(items...)
+	case *TypeParam:
+		if bound, ok := bindings[typ]; ok {
+			return bound
+		}
+	}
+	return typ
+}
+
+// Gives the type args of an application by type param.
+func typeArgBindings(applied *AppliedType) map[*TypeParam]Type {
+	bindings := make(map[*TypeParam]Type, len(applied.Args))
+	for i, param := range applied.Record.TypeParams {
+		if i < len(applied.Args) {
+			bindings[param.(*TypeParam)] = applied.Args[i]
+		}
+	}
+	return bindings
+}
+
+func typeParamsOf(nodes []Node) []*TypeParam {
+	if len(nodes) == 0 {
+		return nil
+	}
+	params := make([]*TypeParam, len(nodes))
+	for i, node := range nodes {
+		params[i] = node.(*TypeParam)
+	}
+	return params
+}
+
+// Notes a call that can fail, which also fails the enclosing fun unless the
+// failure is handled.
+func (t *typer) callFails(c *Call) {
+	if t.try == nil && !isFailCall(c) {
+		t.module.problem(c.Index, "call can fail, so needs try")
+	}
+	if t.try != nil && t.try.Handled {
+		return
+	}
+	if len(t.funs) > 0 {
+		(*last(&t.funs)).Type.Fails = true
+	}
+}
+
+func isFailCall(c *Call) bool {
+	ref, ok := c.Callee.(*Ref)
+	return ok && ref.Target == doFail
+}
+
+func isNumber(t Type) bool {
+	return t == TypeFloat || t == TypeInt
+}
+
+func memberTarget(get *Get) Node {
+	if ref, ok := get.Member.(*Ref); ok {
+		return ref.Target
+	}
+	return nil
+}
+
+// Says if the get is a method on a value rather than a static member.
+func (t *typer) isMethodGet(get *Get) bool {
+	if _, ok := memberTarget(get).(*Fun); !ok {
+		return false
+	}
+	switch t.typeNode(get.Subject, nil).(type) {
+	case *Module, *TypeType:
+		return false
+	}
+	return true
+}
+
+func (t *typer) typeCase(
+	c *Case, wanted Type, subject Node, subjectType Type,
+) Type {
+	var variant *Record
 	for _, pattern := range c.Patterns {
-		t.typeNode(pattern, subjectWanted)
+		resolvePattern(pattern, subjectType)
+		if p, ok := pattern.(*Call); ok {
+			if variant = patternVariant(p); variant != nil {
+				if len(p.Args) != len(variant.Params) {
+					t.module.problem(p.Index, "wrong payload count: "+variant.Name)
+				}
+				if len(c.Patterns) > 1 && hasPatternVars(p) {
+					// Otherwise, var offsets would depend on which matched.
+					t.module.problem(p.Index, "pattern vars need a single pattern")
+				}
+			}
+		}
+		t.pattern = pattern
+		t.typeNode(pattern, subjectType)
+		t.pattern = nil
 	}
 	if c.Gate != nil {
 		t.typeNode(c.Gate, TypeBool)
 	}
+	if v, typ := isCheck(c); v != nil && subject == nil {
+		// As in `if x is Int`.
+		push(&t.narrows, Pair[*Var, Type]{v, typ})
+		defer pop(&t.narrows)
+	}
+	if ref, ok := subject.(*Ref); ok && variant != nil && len(c.Patterns) == 1 {
+		if v, ok := ref.Target.(*Var); ok {
+			// The subject is known to be the variant inside the case.
+			push(&t.narrows, Pair[*Var, Type]{v, variant})
+			defer pop(&t.narrows)
+		}
+	}
 	return t.typeBlockKids(c.Kids, wanted)
 }
 
+// Gives the var and type for a case like `if x is Int`.
+func isCheck(c *Case) (*Var, Type) {
+	if len(c.Patterns) != 1 {
+		return nil, nil
+	}
+	cast, ok := c.Patterns[0].(*Cast)
+	if !ok || cast.Kind != TokenIs || cast.Type == nil {
+		return nil, nil
+	}
+	if ref, ok := cast.Subject.(*Ref); ok {
+		if v, ok := ref.Target.(*Var); ok {
+			return v, cast.Type
+		}
+	}
+	return nil, nil
+}
+
+func (t *typer) typeCast(c *Cast, wanted Type) Type {
+	_ = wanted
+	subjectType := t.typeNode(c.Subject, nil)
+	// Allows bare variant names, as in `shape is Circle`.
+	resolvePattern(c.TypeSpec, subjectType)
+	c.Type = t.typeSpec(c.TypeSpec, nil, c.Index)
+	if subjectType != nil && c.Type != nil && !canBe(subjectType, c.Type) {
+		op, problem := "is", "impossible type test"
+		if c.Kind == TokenAs {
+			op, problem = "as", "impossible cast"
+		}
+		t.module.problem(c.Index, fmt.Sprintf(
+			"%s: %s %s %s", problem, typeName(subjectType), op, typeName(c.Type),
+		))
+	}
+	if c.Kind == TokenIs {
+		return TypeBool
+	}
+	return c.Type
+}
+
+// Says whether values of one type might also be of another.
+func canBe(from, to Type) bool {
+	switch {
+	case from == to, from == TypeAny, to == TypeAny:
+		return true
+	}
+	if present, maybe := presentType(from); maybe {
+		return to == TypeVoid || canBe(present, to)
+	}
+	if present, maybe := presentType(to); maybe {
+		return from == TypeVoid || canBe(from, present)
+	}
+	switch from.(type) {
+	case *AppliedType, *TypeParam:
+		if _, ok := to.(*TypeParam); ok {
+			return true
+		}
+	}
+	switch to.(type) {
+	case *AppliedType, *TypeParam:
+		if _, ok := from.(*TypeParam); ok {
+			return true
+		}
+	}
+	if isApplied(from) || isApplied(to) {
+		// Type args are erased, so only the records matter.
+		return canBe(methodsOf(from), methodsOf(to))
+	}
+	switch from := from.(type) {
+	case ListType:
+		if to, ok := to.(ListType); ok {
+			return canBe(from.ItemType, to.ItemType)
+		}
+	case *Record:
+		if to, ok := to.(*Record); ok {
+			// Between a union and its variants.
+			return from.Union == to || to.Union == from
+		}
+	case *TupleType:
+		if to, ok := to.(*TupleType); ok {
+			if len(from.ItemTypes) != len(to.ItemTypes) {
+				return false
+			}
+			for i, item := range from.ItemTypes {
+				if !canBe(item, to.ItemTypes[i]) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Says whether values of one type always fit where another is wanted, where
+// unknown types fit until known.
+func fits(from, to Type) bool {
+	switch {
+	case from == nil, to == nil, from == to:
+		return true
+	case from == TypeAny, from == TypeNever, to == TypeAny:
+		return true
+	}
+	if present, maybe := presentType(to); maybe {
+		if from == TypeVoid {
+			return true
+		}
+		if fromPresent, fromMaybe := presentType(from); fromMaybe {
+			return fits(fromPresent, present)
+		}
+		return fits(from, present)
+	}
+	if _, maybe := presentType(from); maybe || from == TypeVoid {
+		// Check for none before use.
+		return false
+	}
+	switch from.(type) {
+	case EitherType, *TypeParam, *TypeType:
+		// Checked elsewhere if at all.
+		return true
+	}
+	switch to := to.(type) {
+	case EitherType, *TypeParam, *TypeType:
+		return true
+	case *FunType:
+		from, ok := from.(*FunType)
+		return ok && funFits(from, to)
+	}
+	if isApplied(from) || isApplied(to) {
+		// Type args are checked through binding.
+		return canBe(methodsOf(from), methodsOf(to))
+	}
+	switch from := from.(type) {
+	case ListType:
+		if to, ok := to.(ListType); ok {
+			return fits(from.ItemType, to.ItemType)
+		}
+	case *Record:
+		// Variants fit their union.
+		return from.Union == to
+	case *TupleType:
+		if to, ok := to.(*TupleType); ok {
+			if len(from.ItemTypes) != len(to.ItemTypes) {
+				return false
+			}
+			for i, item := range from.ItemTypes {
+				if !fits(item, to.ItemTypes[i]) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Params must accept whatever callers pass, and results must fit what they
+// expect.
+func funFits(from, to *FunType) bool {
+	if len(from.ParamTypes) != len(to.ParamTypes) {
+		return false
+	}
+	for i, param := range from.ParamTypes {
+		if !fits(to.ParamTypes[i], param) {
+			return false
+		}
+	}
+	// Results can be ignored.
+	return to.RetType == TypeVoid || fits(from.RetType, to.RetType)
+}
+
+func isApplied(t Type) bool {
+	_, ok := t.(*AppliedType)
+	return ok
+}
+
+func hasPatternVars(p *Call) bool {
+	for _, a := range p.Args {
+		if _, ok := a.(*Var); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Gives what makes a pattern a repeat of another, if simple enough to know,
+// along with the pattern index.
+func patternKey(pattern Node) (any, int) {
+	switch p := pattern.(type) {
+	case *Ref:
+		return p.Target, p.Index
+	case *Value:
+		return p.Value, p.Index
+	}
+	return nil, 0
+}
+
+// Gives the record of methods for built-in and applied types, else the type
+// itself.
+func methodsOf(typ Type) Type {
+	switch typ {
+	case TypeFloat:
+		return floatType
+	case TypeInt:
+		return intType
+	case TypeString:
+		return stringType
+	}
+	if applied, ok := typ.(*AppliedType); ok {
+		return applied.Record
+	}
+	return typ
+}
+
+// Finds the eq fun for matching switch subjects, if the type has one.
+func eqMember(typ Type) Node {
+	if _, maybe := presentType(typ); maybe {
+		return anyEq
+	}
+	if rec, ok := methodsOf(typ).(*Record); ok {
+		if eq, ok := rec.MemberMap["eq"].(*Fun); ok {
+			return eq
+		}
+	}
+	return nil
+}
+
+// Allows bare member names when switching on an enum or union.
+func resolvePattern(pattern Node, subjectType Type) {
+	ref, ok := pattern.(*Ref)
+	if call, isCall := pattern.(*Call); isCall {
+		ref, ok = call.Callee.(*Ref)
+	}
+	if !ok || ref.Target != nil {
+		return
+	}
+	rec, ok := methodsOf(subjectType).(*Record)
+	if !ok || (rec.Kind != TokenEnum && rec.Kind != TokenUnion) {
+		return
+	}
+	switch member := rec.MemberMap[ref.Name].(type) {
+	case *Record, *Tag:
+		ref.Target = member
+	}
+}
+
+// Gives the variant for destructuring patterns, as in `case Some(var x)`.
+func patternVariant(p *Call) *Record {
+	if rec, ok := patternMember(p.Callee).(*Record); ok && rec.Union != nil {
+		return rec
+	}
+	return nil
+}
+
+func (t *typer) typeFor(f *For, wanted Type) Type {
+	if f.Item != nil {
+		subjectType := t.typeNode(f.Subject, nil)
+		item, ok := itemType(subjectType)
+		if !ok {
+			t.module.problem(f.Index, fmt.Sprintf(
+				"not iterable: %s", typeName(subjectType),
+			))
+		}
+		t.typeNode(f.Item, item)
+	} else if f.Subject != nil {
+		switch subjectType := t.typeNode(f.Subject, TypeBool); subjectType {
+		case nil, TypeBool, TypeNever:
+		default:
+			t.module.problem(f.Index, fmt.Sprintf(
+				"wrong condition type: got %s, want Bool", typeName(subjectType),
+			))
+		}
+	}
+	for _, n := range f.Kids {
+		t.typeKid(n, nil)
+	}
+	typ := f.Type
+	if f.Subject != nil {
+		// Can end without break.
+		typ = joinTypes(typ, TypeVoid)
+	} else if typ == nil {
+		typ = TypeNever
+	}
+	return typ
+}
+
 func (t *typer) typeFun(f *Fun, wanted Type) Type {
 	// TODO If already typed, just fill in blanks.
 	// TODO Could we have blanks only in type parameters?
@@ -160,6 +1032,19 @@ func (t *typer) typeFun(f *Fun, wanted Type) Type {
 	}
 	wantedTypeType := push(&t.typeTypes, TypeType{Type: wantedRetType})
 	defer pop(&t.typeTypes)
+	push(&t.funs, f)
+	defer pop(&t.funs)
+	// Tries outside don't cover calls inside.
+	outerTry := t.try
+	t.try = nil
+	defer func() { t.try = outerTry }()
+	// Vartypes in the body also apply to params.
+	vartypesLen := len(t.vartypes)
+	defer func() { t.vartypes = t.vartypes[:vartypesLen] }()
+	t.pushVartypes(f.Kids)
+	if len(f.TypeParams) > 0 {
+		f.Type.TypeParams = typeParamsOf(f.TypeParams)
+	}
 	specType := t.typeNode(f.RetSpec, wantedTypeType)
 	if specTypeType, ok := specType.(*TypeType); ok {
 		if f.Type.RetType == nil {
@@ -174,7 +1059,8 @@ func (t *typer) typeFun(f *Fun, wanted Type) Type {
 		if wantedOk && i < len(wantedFunType.ParamTypes) {
 			paramWanted = wantedFunType.ParamTypes[i]
 		}
-		paramType := t.typeNode(p, paramWanted)
+		t.typeNode(p, paramWanted)
+		paramType := p.(*Var).Type
 		if paramTypesNeeded {
 			if i < len(f.Type.ParamTypes) {
 				f.Type.ParamTypes[i] = paramType
@@ -185,11 +1071,32 @@ func (t *typer) typeFun(f *Fun, wanted Type) Type {
 		}
 	}
 	for _, n := range f.Kids {
-		t.typeNode(n, nil)
+		t.typeKid(n, nil)
 	}
 	return &f.Type
 }
 
+func (t *typer) typeFunSpec(f *FunSpec, wanted Type) Type {
+	_ = wanted
+	specWanted := push(&t.typeTypes, TypeType{})
+	defer pop(&t.typeTypes)
+	specType := func(spec Node) Type {
+		if typeType, ok := t.typeNode(spec, specWanted).(*TypeType); ok {
+			return typeType.Type
+		}
+		return nil
+	}
+	funType := &FunType{RetType: TypeVoid}
+	for _, param := range f.Params {
+		funType.ParamTypes = append(funType.ParamTypes, specType(param))
+	}
+	if f.RetSpec != nil {
+		funType.RetType = specType(f.RetSpec)
+	}
+	f.Meta.Type = funType
+	return &f.Meta
+}
+
 func (t *typer) typeGet(g *Get, wanted Type) Type {
 	// TODO
 	// Resolve on the spot for members.
@@ -199,50 +1106,260 @@ func (t *typer) typeGet(g *Get, wanted Type) Type {
 	// depend on member gets.
 	var typ Type
 	subjectType := t.typeNode(g.Subject, nil)
+	list, isList := subjectType.(ListType)
+	tuple, isTuple := subjectType.(*TupleType)
+	applied, isApplied := subjectType.(*AppliedType)
 	switch m := g.Member.(type) {
 	case *Ref:
-		switch m.Target {
-		case nil:
-			switch subjectType {
-			case TypeInt:
-				subjectType = intType
+		if _, maybe := presentType(subjectType); maybe {
+			if m.Name != "eq" {
+				t.module.problem(g.Index, "check for none before use: "+m.Name)
+				return nil
+			}
+			// Checking for none is fine.
+			m.Target = anyEq
+		}
+		if subjectType == TypeAny && m.Name == "eq" {
+			// Any values can only compare by identity.
+			m.Target = anyEq
+		}
+		if m.Target == nil {
+			if isList {
+				subjectType = listType
 			}
-			switch record := subjectType.(type) {
+			if isTuple {
+				subjectType = tupleType
+			}
+			if meta, ok := subjectType.(*TypeType); ok {
+				// Static members, such as enum tags.
+				subjectType = meta.Type
+			}
+			switch subject := methodsOf(subjectType).(type) {
+			case *Module:
+				// Already typed when the import was analyzed.
+				member, problem := pubTop(subject, m.Name)
+				if member == nil {
+					t.module.problem(g.Index, problem)
+					return nil
+				}
+				m.Target = member
 			case *Record:
-				if member, ok := record.MemberMap[m.Name]; ok {
-					typ = t.typeNode(member, nil)
-					// fmt.Printf("typ: %v\n", typ)
-					m.Target = member
+				member, ok := subject.MemberMap[m.Name]
+				if !ok {
+					t.module.problem(g.Index, "unknown member: "+m.Name)
+					return nil
 				}
+				t.typeNode(member, nil)
+				m.Target = member
 			}
 			// fmt.Printf("subjectType: %+v\n", subjectType)
 			// fmt.Printf("m: %v\n", m)
-		default:
-			switch n := m.Target.(type) {
-			case *Fun:
-				// TODO Bound type, not raw.
-				typ = &n.Type
-			case *Var:
-				typ = n.Type
+		}
+		switch n := m.Target.(type) {
+		case *Fun:
+			// TODO Bound type, not raw.
+			typ = &n.Type
+			if isList {
+				typ = listMethodType(n, list)
 			}
+			if isTuple {
+				typ = tupleMethodType(n, tuple)
+			}
+		case *Record:
+			typ = recordRefType(n, wanted)
+		case *Tag:
+			typ = tagType(n, wanted)
+		case *Var:
+			typ = n.Type
+		}
+		if isApplied {
+			// Members use the type args of their subject.
+			typ = t.bindType(typ, typeArgBindings(applied))
 		}
 	}
 	return typ
 }
 
+// Gives the type of a tag, where generic unions take any wanted type args.
+func tagType(tag *Tag, wanted Type) Type {
+	if len(tag.Type.TypeParams) == 0 {
+		return tag.Type
+	}
+	if applied, ok := wanted.(*AppliedType); ok && applied.Record == tag.Type {
+		return wanted
+	}
+	return tag.Type.Meta.Type
+}
+
+func (t *typer) typeList(l *List, wanted Type) Type {
+	if _, ok := wanted.(*TypeType); ok && len(l.Items) == 1 {
+		// List type, as in `*Int` or `[Int]`.
+		itemWanted := push(&t.typeTypes, TypeType{})
+		defer pop(&t.typeTypes)
+		if item, ok := t.typeNode(l.Items[0], itemWanted).(*TypeType); ok {
+			l.Meta.Type = ListType{ItemType: item.Type}
+		}
+		return &l.Meta
+	}
+	var itemWanted Type
+	if list, ok := wanted.(ListType); ok {
+		itemWanted = list.ItemType
+	}
+	var item Type
+	for _, n := range l.Items {
+		item = joinTypes(item, t.typeNode(n, itemWanted))
+	}
+	if itemWanted != nil && fits(item, itemWanted) {
+		// Otherwise keep the actual type so the mismatch gets reported.
+		item = itemWanted
+	}
+	l.Type = ListType{ItemType: item}
+	return l.Type
+}
+
+func (t *typer) typeLogic(l *Logic, wanted Type) Type {
+	_ = wanted
+	for _, a := range l.Args {
+		switch argType := t.typeNode(a, TypeBool); argType {
+		case nil, TypeBool, TypeNever:
+		default:
+			t.module.problem(l.Index, fmt.Sprintf(
+				"wrong operand type: got %s, want Bool", typeName(argType),
+			))
+		}
+	}
+	return TypeBool
+}
+
+// Gives list method types specialized to the item type.
+func listMethodType(f *Fun, list ListType) Type {
+	item := list.ItemType
+	switch f {
+	case listEach:
+		each := &FunType{ParamTypes: []Type{item}}
+		return &FunType{ParamTypes: []Type{list, each}, RetType: TypeVoid}
+	case listFilter:
+		keep := &FunType{ParamTypes: []Type{item}, RetType: TypeBool}
+		return &FunType{ParamTypes: []Type{list, keep}, RetType: list}
+	case listGet:
+		return &FunType{ParamTypes: []Type{list, TypeInt}, RetType: item}
+	case listLen:
+		return &FunType{ParamTypes: []Type{list}, RetType: TypeInt}
+	case listMap:
+		// The call fills in the result type from the fun arg.
+		mapper := &FunType{ParamTypes: []Type{item}}
+		return &FunType{ParamTypes: []Type{list, mapper}}
+	case listPop:
+		return &FunType{ParamTypes: []Type{list}, RetType: item}
+	case listPush:
+		return &FunType{ParamTypes: []Type{list, item}, RetType: TypeVoid}
+	case listSet:
+		params := []Type{list, TypeInt, item}
+		return &FunType{ParamTypes: params, RetType: TypeVoid}
+	}
+	return &f.Type
+}
+
+// Gives tuple method types for the tuple, where calls type get by index.
+func tupleMethodType(f *Fun, tuple *TupleType) Type {
+	switch f {
+	case tupleGet:
+		return &FunType{ParamTypes: []Type{tuple, TypeInt}}
+	case tupleLen:
+		return &FunType{ParamTypes: []Type{tuple}, RetType: TypeInt}
+	}
+	return &f.Type
+}
+
+func (t *typer) typeMaybe(m *Maybe, wanted Type) Type {
+	_ = wanted
+	itemWanted := push(&t.typeTypes, TypeType{})
+	defer pop(&t.typeTypes)
+	if item, ok := t.typeNode(m.Item, itemWanted).(*TypeType); ok {
+		m.Meta.Type = maybeType(item.Type)
+	}
+	return &m.Meta
+}
+
+func (t *typer) typeRecord(r *Record, wanted Type) Type {
+	_ = wanted
+	r.Meta.Type = r
+	if len(r.TypeParams) > 0 {
+		// Generic records are their own type args inside themselves.
+		args := make([]Type, len(r.TypeParams))
+		for i, param := range r.TypeParams {
+			args[i] = param
+		}
+		r.Meta.Type = t.applyType(r, args)
+		r.Type.TypeParams = typeParamsOf(r.TypeParams)
+	}
+	r.Type.RetType = r.Meta.Type
+	if r.Union != nil {
+		// Variants construct values of their union type.
+		r.Type.RetType = r.Union.Meta.Type
+		r.Type.TypeParams = r.Union.Type.TypeParams
+	}
+	r.Type.ParamTypes = r.Type.ParamTypes[:0]
+	for _, p := range r.Params {
+		t.typeNode(p, nil)
+		r.Type.ParamTypes = append(r.Type.ParamTypes, p.(*Var).Type)
+	}
+	for _, n := range r.Kids {
+		t.typeNode(n, nil)
+	}
+	if r.Kind == TokenStruct && structContains(r, r, nil) {
+		t.module.problem(r.Index, "struct contains itself: "+r.Name)
+	}
+	return &r.Meta
+}
+
+// Says if required fields of outer lead to target, which for a struct would
+// need infinite size.
+func structContains(outer *Record, target *Record, seen []*Record) bool {
+	for _, s := range seen {
+		if s == outer {
+			return false
+		}
+	}
+	seen = append(seen, outer)
+	for _, member := range outer.Members {
+		v, ok := member.(*Var)
+		if !ok || !isStruct(v.Type) {
+			continue
+		}
+		field := methodsOf(v.Type).(*Record)
+		if field == target || structContains(field, target, seen) {
+			return true
+		}
+	}
+	return false
+}
+
 func (t *typer) typeReturn(r *Return, wanted Type) Type {
 	_ = wanted
 	// TODO Pass in wanted if we know the target/return type.
 	valueType := t.typeNode(r.Value, nil)
 	if r.Target != nil {
 		switch target := r.Target.(type) {
+		case *For:
+			if r.Kind == TokenBreak && r.Value != nil {
+				target.Type = joinTypes(target.Type, valueType)
+			}
 		case *Fun:
-			// First in tree order wins.
-			if target.Type.RetType == nil {
-				target.Type.RetType = valueType
+			switch {
+			case r.Kind == TokenYield:
+				target.Type.YieldType = joinTypes(target.Type.YieldType, valueType)
+				// Resumes continue after the yield.
+				return TypeVoid
+			case target.RetSpec == nil:
+				// Explicit return types win over inferred.
+				target.Type.RetType = joinTypes(target.Type.RetType, valueType)
 			}
 		}
 	}
+	if r.Kind == TokenYield {
+		return TypeVoid
+	}
 	return TypeNever
 }
 
@@ -251,35 +1368,365 @@ func (t *typer) typeRef(r *Ref, wanted Type) Type {
 	switch n := r.Target.(type) {
 	case *Fun:
 		return &n.Type
+	case *Import:
+		if n.Module == nil {
+			return nil
+		}
+		return n.Module
+	case *Record:
+		return recordRefType(n, wanted)
+	case *Tag:
+		return tagType(n, wanted)
+	case *TypeParam:
+		return &n.Meta
+	case *TypeType:
+		return n
+	case *Value:
+		return t.typeValue(n, wanted)
 	case *Var:
+		for i := len(t.narrows) - 1; i >= 0; i-- {
+			if t.narrows[i].First == n {
+				return t.narrows[i].Second
+			}
+		}
 		return n.Type
 	}
 	return nil
 }
 
+func recordRefType(r *Record, wanted Type) Type {
+	constructable := r.Kind == TokenClass || r.Kind == TokenStruct
+	if _, ok := wanted.(*TypeType); ok || !constructable {
+		return &r.Meta
+	}
+	// Otherwise presume a constructor call.
+	return &r.Type
+}
+
+// Types a spec in type position, as for vars and casts, reporting any that
+// isn't a type at the given node index.
+func (t *typer) typeSpec(spec Node, wanted Type, index int) Type {
+	wantedTypeType := push(&t.typeTypes, TypeType{Type: wanted})
+	defer pop(&t.typeTypes)
+	typeType, ok := t.typeNode(spec, wantedTypeType).(*TypeType)
+	if !ok {
+		message := "not a type"
+		if ref, ok := spec.(*Ref); ok {
+			message += ": " + ref.Name
+		}
+		t.module.problem(index, message)
+		return nil
+	}
+	return typeType.Type
+}
+
 func (t *typer) typeSwitch(s *Switch, wanted Type) Type {
 	var typ Type
 	var subjectType Type = TypeBool
 	if s.Subject != nil {
 		subjectType = t.typeNode(s.Subject, nil)
+		s.Eq = eqMember(subjectType)
 	}
+	// Repeated patterns can't match, unless an earlier one has a guard.
+	seen := map[any]bool{}
+	// Once a case handles none, optional vars are present for later cases.
+	narrowsLen := len(t.narrows)
+	defer func() { t.narrows = t.narrows[:narrowsLen] }()
+	subjectVar := maybeVar(s.Subject)
+	always := false
 	for i, k := range s.Kids {
 		switch c := k.(type) {
 		case *Case:
-			caseType := t.typeCase(c, wanted, subjectType)
+			noneCase := hasNonePattern(c)
+			var presentVar *Var
+			switch {
+			case subjectVar != nil && !c.Always && !noneCase:
+				presentVar = subjectVar
+			case s.Subject == nil:
+				presentVar = presentCheckVar(c)
+			}
+			if presentVar != nil {
+				t.narrowPresent(presentVar)
+			}
+			caseType := t.typeCase(c, wanted, s.Subject, subjectType)
+			if presentVar != nil {
+				pop(&t.narrows)
+			}
+			t.checkRepeats(c, seen)
+			switch {
+			case c.Gate != nil:
+				// Guarded cases might not match.
+			case subjectVar != nil && noneCase:
+				t.narrowPresent(subjectVar)
+			case s.Subject == nil:
+				if v := noneCheckVar(c); v != nil {
+					t.narrowPresent(v)
+				}
+			}
+			always = always || c.Always
 			if i == 0 {
 				typ = caseType
+			} else {
+				typ = joinTypes(typ, caseType)
 			}
 		default:
 			t.typeNode(c, nil)
 		}
 	}
+	if !always {
+		rec, ok := methodsOf(subjectType).(*Record)
+		if ok && (rec.Kind == TokenEnum || rec.Kind == TokenUnion) {
+			t.checkExhaustive(s, rec)
+			return typ
+		}
+		if typ != nil {
+			// Falling through all cases yields nothing.
+			typ = joinTypes(typ, TypeVoid)
+		}
+	}
 	return typ
 }
 
+func (t *typer) checkRepeats(c *Case, seen map[any]bool) {
+	for _, pattern := range c.Patterns {
+		key, index := patternKey(pattern)
+		if key == nil {
+			continue
+		}
+		if seen[key] {
+			t.module.problem(index, "duplicate pattern")
+		}
+		if c.Gate == nil {
+			seen[key] = true
+		}
+	}
+}
+
+func (t *typer) narrowPresent(v *Var) {
+	present, _ := presentType(v.Type)
+	push(&t.narrows, Pair[*Var, Type]{v, present})
+}
+
+// Gives the var referenced by node if it has optional type.
+func maybeVar(node Node) *Var {
+	if ref, ok := node.(*Ref); ok {
+		if v, ok := ref.Target.(*Var); ok {
+			if _, maybe := presentType(v.Type); maybe {
+				return v
+			}
+		}
+	}
+	return nil
+}
+
+func hasNonePattern(c *Case) bool {
+	for _, pattern := range c.Patterns {
+		if isNone(pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func isNone(node Node) bool {
+	ref, ok := node.(*Ref)
+	return ok && ref.Target == noneValue
+}
+
+// Gives the optional var for a case like `if x == none`.
+func noneCheckVar(c *Case) *Var {
+	if len(c.Patterns) != 1 {
+		return nil
+	}
+	return noneCheckOf(c.Patterns[0])
+}
+
+// Gives the optional var for a case like `if x != none`.
+func presentCheckVar(c *Case) *Var {
+	if len(c.Patterns) != 1 {
+		return nil
+	}
+	l, ok := c.Patterns[0].(*Logic)
+	if !ok || l.Kind != TokenNot {
+		return nil
+	}
+	return noneCheckOf(l.Args[0])
+}
+
+func noneCheckOf(node Node) *Var {
+	call, ok := node.(*Call)
+	if !ok || len(call.Args) != 1 || !isNone(call.Args[0]) {
+		return nil
+	}
+	get, ok := call.Callee.(*Get)
+	if !ok || memberTarget(get) != anyEq {
+		return nil
+	}
+	return maybeVar(get.Subject)
+}
+
+// Reports any enum tags or union variants not covered by switch cases.
+func (t *typer) checkExhaustive(s *Switch, rec *Record) {
+	missing := ""
+Members:
+	for _, member := range rec.Members {
+		name := ""
+		switch m := member.(type) {
+		case *Record:
+			name = m.Name
+		case *Tag:
+			name = m.Name
+		default:
+			continue Members
+		}
+		for _, k := range s.Kids {
+			if c, ok := k.(*Case); ok && c.Gate == nil {
+				for _, pattern := range c.Patterns {
+					if patternCovers(pattern) == member {
+						continue Members
+					}
+				}
+			}
+		}
+		if missing != "" {
+			missing += ", "
+		}
+		missing += name
+	}
+	if missing != "" {
+		t.module.problem(s.Index, "switch missing cases: "+missing)
+	}
+}
+
+// Gives the member fully covered by a pattern, if any.
+func patternCovers(pattern Node) Node {
+	if p, ok := pattern.(*Call); ok {
+		for _, a := range p.Args {
+			if _, ok := a.(*Var); !ok {
+				// Payload values narrow the match.
+				return nil
+			}
+		}
+		if variant := patternVariant(p); variant != nil {
+			return variant
+		}
+		return nil
+	}
+	return patternMember(pattern)
+}
+
+func patternMember(pattern Node) Node {
+	switch p := pattern.(type) {
+	case *Get:
+		return patternMember(p.Member)
+	case *Ref:
+		return p.Target
+	}
+	return nil
+}
+
+func (t *typer) typeTry(tr *Try, wanted Type) Type {
+	outerTry := t.try
+	t.try = tr
+	typ := t.typeNode(tr.Subject, wanted)
+	t.try = outerTry
+	if !tr.Handled {
+		return typ
+	}
+	if tr.Error != nil {
+		t.typeNode(tr.Error, errorType)
+	}
+	return joinTypes(typ, t.typeBlockKids(tr.Kids, wanted))
+}
+
+func (t *typer) typeTuple(tu *Tuple, wanted Type) Type {
+	if len(tu.Items) < 2 {
+		t.module.problem(tu.Index, "tuple needs at least two items")
+		return nil
+	}
+	items := make([]Type, len(tu.Items))
+	if _, ok := wanted.(*TypeType); ok {
+		// Tuple type, as in `(Int, String)`.
+		itemWanted := push(&t.typeTypes, TypeType{})
+		defer pop(&t.typeTypes)
+		for i, item := range tu.Items {
+			if item, ok := t.typeNode(item, itemWanted).(*TypeType); ok {
+				items[i] = item.Type
+			}
+		}
+		tu.Meta.Type = tupleOf(items...)
+		return &tu.Meta
+	}
+	tuple, _ := wanted.(*TupleType)
+	for i, item := range tu.Items {
+		var itemWanted Type
+		if tuple != nil && i < len(tuple.ItemTypes) {
+			itemWanted = tuple.ItemTypes[i]
+		}
+		items[i] = t.typeNode(item, itemWanted)
+	}
+	tu.Type = tupleOf(items...)
+	return tu.Type
+}
+
+// Gives the type of a tuple item by constant index.
+func (t *typer) tupleItemType(c *Call, tuple *TupleType, index Node) Type {
+	if tuple == nil {
+		return nil
+	}
+	i, ok := int32(0), false
+	if value, isValue := index.(*Value); isValue {
+		i, ok = value.Value.(int32)
+	}
+	switch {
+	case !ok:
+		t.module.problem(c.Index, "tuple index not constant")
+		return nil
+	case i < 0 || int(i) >= len(tuple.ItemTypes):
+		t.module.problem(c.Index, fmt.Sprintf(
+			"tuple index out of range: %d of %d", i, len(tuple.ItemTypes),
+		))
+		return nil
+	}
+	return tuple.ItemTypes[i]
+}
+
+func (t *typer) typeUnpack(u *Unpack, wanted Type) Type {
+	_ = wanted
+	valueType := t.typeNode(u.Value, nil)
+	if valueType == nil {
+		return nil
+	}
+	tuple, ok := valueType.(*TupleType)
+	if !ok {
+		t.module.problem(u.Index, "not a tuple: "+typeName(valueType))
+		return nil
+	}
+	if len(u.Vars) != len(tuple.ItemTypes) {
+		t.module.problem(u.Index, fmt.Sprintf(
+			"wrong unpack count: got %d, want %d",
+			len(u.Vars), len(tuple.ItemTypes),
+		))
+	}
+	for i, v := range u.Vars {
+		if v := v.(*Var); v.Type == nil && i < len(tuple.ItemTypes) {
+			v.Type = tuple.ItemTypes[i]
+		}
+	}
+	// The unpack itself is type nil, like other var declarations.
+	return nil
+}
+
 func (t *typer) typeValue(value *Value, wanted Type) Type {
 	_ = wanted
 	switch value.Value.(type) {
+	case nil:
+		// None.
+		return TypeVoid
+	case bool:
+		return TypeBool
+	case float64:
+		return TypeFloat
 	case int32:
 		return TypeInt
 	case string:
@@ -297,13 +1744,7 @@ func (t *typer) typeVar(v *Var, wanted Type) Type {
 		case nil:
 			switch wanted {
 			case nil:
-				// TODO Prioritize vartype specs over defaults.
-				switch v.Name {
-				case "i", "j", "k", "l", "m", "n":
-					typ = TypeInt
-				case "w", "x", "y", "Z":
-					typ = TypeFloat
-				}
+				typ = t.vartypeOf(v.Name)
 			default:
 				typ = wanted
 			}
@@ -312,19 +1753,23 @@ func (t *typer) typeVar(v *Var, wanted Type) Type {
 			valueTyped = true
 		}
 	default:
-		wantedTypeType := push(&t.typeTypes, TypeType{Type: wanted})
-		defer pop(&t.typeTypes)
-		typeType := t.typeNode(v.TypeSpec, wantedTypeType)
-		if typeType, ok := typeType.(*TypeType); ok {
-			typ = typeType.Type
-		}
+		typ = t.typeSpec(v.TypeSpec, wanted, v.Index)
+	}
+	if v.Flags&NodeFlagOptional != 0 {
+		// As in `vel?` for struct fields.
+		typ = maybeType(typ)
 	}
 	if v.Type == nil {
 		// TODO Could we have blanks only in type parameters?
 		v.Type = typ
 	}
 	if v.Value != nil && !valueTyped {
-		t.typeNode(v.Value, v.Type)
+		if valueType := t.typeNode(v.Value, v.Type); !fits(valueType, v.Type) {
+			t.module.problem(v.Index, fmt.Sprintf(
+				"wrong var type: got %s, want %s",
+				typeName(valueType), typeName(v.Type),
+			))
+		}
 	}
 	// The var declaration itself is type nil.
 	return nil